@@ -0,0 +1,54 @@
+package srpc
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"net/netip"
+)
+
+// RequestIDHeader is the header that carries the ID of a request.
+//
+// Endpoints using [WithAccessLog] reuse the ID sent by clients or proxies, or generate a new one,
+// and send it back in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// WithAccessLog makes endpoints log a line for every request they serve, once the response is sent,
+// at the info level.
+//
+// The line is logged for failed requests too, with the final status, and carries the method, route pattern,
+// status, bytes read and written by the codecs, duration, request ID and client IP.
+func WithAccessLog() ServerOption {
+	return func(c *serverConfig) { c.accessLog = true }
+}
+
+// RequestIDFromContext returns the ID of the request being served, if the endpoint uses [WithAccessLog].
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID returns the ID of hReq, generating one if the client didn't send it,
+// sets it on the response header h and stores it in ctx.
+func withRequestID(ctx context.Context, hReq *http.Request, h http.Header) (context.Context, string) {
+	id := hReq.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = rand.Text()
+	}
+	h.Set(RequestIDHeader, id)
+	return context.WithValue(ctx, requestIDKey{}, id), id
+}
+
+// logAccess logs the access line for hReq, sent by ip and served as described by ev.
+func logAccess(ctx context.Context, hReq *http.Request, id string, ip netip.Addr, ev ServerEvent) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "Access",
+		slog.String("method", hReq.Method),
+		slog.String("endpoint", ev.Method+" "+ev.Path),
+		slog.Int("status", ev.Status),
+		slog.Int64("bytes_in", ev.BytesIn),
+		slog.Int64("bytes_out", ev.BytesOut),
+		slog.Duration("duration", ev.Duration),
+		slog.String("request_id", id),
+		slog.String("client_ip", ip.String()))
+}
@@ -0,0 +1,221 @@
+package srpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// arrayFlushInterval is the maximum time elements of a JSON array stay buffered before being flushed.
+const arrayFlushInterval = 100 * time.Millisecond
+
+// NewCodecJSONArray constructs a codec for sequences of values encoded as a single JSON array.
+//
+// Unlike [NewCodecSeq] and [NewCodecStream] the wire format is plain JSON, so it can be consumed by any client.
+// Elements are encoded while the response is sent and flushed periodically, and they are decoded one at a time,
+// so neither side needs to hold the whole array in memory.
+//
+// If the encoded sequence yields an error the array is truncated, servers report the error
+// in the response trailers and clients yield it as the last element.
+func NewCodecJSONArray[T any]() Codec[iter.Seq2[T, error]] {
+	return Codec[iter.Seq2[T, error]]{
+		ContentType: "application/json",
+		KeepOpen:    true,
+		Co: func(ctx context.Context, seq iter.Seq2[T, error]) (io.Reader, error) {
+			return &wireArray[T]{ctx: ctx, seq: seq}, nil
+		},
+		Dec: func(_ context.Context, r io.Reader) (iter.Seq2[T, error], error) {
+			return func(yield func(T, error) bool) {
+				defer func() {
+					if c, ok := r.(io.Closer); ok {
+						_ = c.Close()
+					}
+				}()
+				var zero T
+				dec := json.NewDecoder(r)
+				if err := expectDelim(dec, '['); err != nil {
+					yield(zero, err)
+					return
+				}
+				for dec.More() {
+					var t T
+					if err := dec.Decode(&t); err != nil {
+						yield(zero, fmt.Errorf("decoding array element: %w", err))
+						return
+					}
+					if !yield(t, nil) {
+						return
+					}
+				}
+				if err := expectDelim(dec, ']'); err != nil {
+					yield(zero, err)
+					return
+				}
+				// Read until EOF to surface errors reported in the trailers.
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					yield(zero, err)
+				}
+			}, nil
+		},
+	}
+}
+
+// expectDelim reads the next token of dec and checks that it is the delimiter d.
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("decoding array: %w", err)
+	}
+	if tok != d {
+		return fmt.Errorf("decoding array: want %v, got %v", d, tok)
+	}
+	return nil
+}
+
+// wireArray encodes a sequence as a JSON array.
+//
+// It is meant to be copied with [io.Copy], which uses WriteTo to flush elements as they are written.
+// Read is supported for writers that are not flushable, for example request bodies.
+type wireArray[T any] struct {
+	ctx context.Context //nolint: containedctx // the sequence is consumed within the request lifetime.
+	seq iter.Seq2[T, error]
+
+	once sync.Once
+	pr   *io.PipeReader
+}
+
+func (a *wireArray[T]) Read(p []byte) (int, error) {
+	a.once.Do(func() {
+		pr, pw := io.Pipe()
+		a.pr = pr
+		go func() {
+			_, err := a.WriteTo(pw)
+			_ = pw.CloseWithError(err)
+		}()
+	})
+	return a.pr.Read(p)
+}
+
+// Close stops the encoding if it was started by Read.
+func (a *wireArray[T]) Close() error {
+	a.once.Do(func() {})
+	if a.pr != nil {
+		return a.pr.Close()
+	}
+	return nil
+}
+
+func (*wireArray[T]) stopsWithContext() {}
+
+func (a *wireArray[T]) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriterSize(cw, copyBufSize)
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	// Elements stay buffered for at most arrayFlushInterval, even if the sequence blocks, so the timer
+	// also flushes. mu guards the writers and the fields below.
+	var (
+		mu      sync.Mutex
+		armed   bool
+		stopped bool
+	)
+	timer := time.AfterFunc(arrayFlushInterval, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		armed = false
+		if !stopped {
+			_ = flush()
+		}
+	})
+	timer.Stop()
+	// stop prevents the timer from writing once WriteTo returns, and returns the bytes written.
+	stop := func() int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		timer.Stop()
+		return cw.n
+	}
+
+	if err := bw.WriteByte('['); err != nil {
+		return stop(), err
+	}
+	first := true
+	emit := func(v T, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			_ = flush()
+			return err
+		}
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			_ = flush()
+			return err
+		}
+		if !first {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		switch {
+		case first:
+			if err := flush(); err != nil {
+				return err
+			}
+		case !armed:
+			armed = true
+			timer.Reset(arrayFlushInterval)
+		}
+		first = false
+		return nil
+	}
+	if a.seq != nil {
+		for v, err := range a.seq {
+			if err := emit(v, err); err != nil {
+				return stop(), err
+			}
+		}
+	}
+	stop()
+	if err := bw.WriteByte(']'); err != nil {
+		return cw.n, err
+	}
+	err := flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to the wrapped writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
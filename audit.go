@@ -0,0 +1,34 @@
+package srpc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Auditor records the requests served by endpoints, for example to an audit store.
+type Auditor interface {
+	// Audit records r, whose encoded request is body: the request body or, for requests sent in the URL,
+	// the query that carries the request.
+	//
+	// If it returns an error the request is rejected, without calling the procedure, with the error status
+	// if it implements [ErrorResponse], or with 500 Internal Server Error otherwise.
+	Audit(ctx context.Context, r *http.Request, body []byte) error
+}
+
+// AuditorFunc is an adapter to use ordinary functions as [Auditor].
+type AuditorFunc func(ctx context.Context, r *http.Request, body []byte) error
+
+// Audit implements [Auditor].
+func (f AuditorFunc) Audit(ctx context.Context, r *http.Request, body []byte) error {
+	return f(ctx, r, body)
+}
+
+// WithAuditor makes endpoints pass the encoded requests they serve to a, after decoding and validating them
+// and before calling the procedure.
+//
+// Requests are captured while they are decoded, so a receives what the request codec read: the whole message
+// for most codecs, but only the part read before the procedure is called for the streaming ones.
+// The message is kept in memory, so it is meant to be enabled on the endpoints that need auditing.
+func WithAuditor(a Auditor) ServerOption {
+	return func(c *serverConfig) { c.auditor = a }
+}
@@ -0,0 +1,269 @@
+package srpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// batchItem is a single call carried by a batch request.
+type batchItem struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// batchResult is the outcome of a single call carried by a batch response.
+type batchResult struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// newBatchEndpoint returns the endpoint that carries batches on path.
+func newBatchEndpoint(path string) Endpoint[[]batchResult, []batchItem] {
+	return NewEndpointJSON[[]batchResult, []batchItem](http.MethodPost, path)
+}
+
+// Default limits of the batches served by [RegisterBatch], see [WithBatchLimits].
+const (
+	defaultBatchMaxItems    = 100
+	defaultBatchConcurrency = 8
+)
+
+// WithBatchLimits limits the batches served by [RegisterBatch] to maxItems calls, of which at most
+// concurrency are served at a time. Non-positive values keep the defaults of 100 calls and 8 at a time.
+//
+// Batches with more calls are rejected with 413 Request Entity Too Large.
+func WithBatchLimits(maxItems, concurrency int) ServerOption {
+	return func(c *serverConfig) {
+		c.batchMaxItems = maxItems
+		c.batchConcurrency = concurrency
+	}
+}
+
+// RegisterBatch registers on m, at path, a POST endpoint that serves batches of calls sent with [Batch].
+//
+// Each call in a batch is served by h, which is usually the [http.ServeMux] the endpoints are registered on,
+// with the headers of the batch request except the ones that only apply to it: signatures, timeouts and
+// idempotency keys. Calls get the idempotency key of the batch followed by their index, and the deadline
+// of the batch. If the batch endpoint has a [Verifier], calls are covered by the signature of the batch
+// and are not verified again. Calls are served concurrently, within the limits set with
+// [WithBatchLimits], and each one gets its own status, so individual failures don't fail the whole batch.
+func RegisterBatch(m Mux, path string, h http.Handler, opts ...ServerOption) {
+	cfg := newServerConfig(m, opts)
+	maxItems, concurrency := cfg.batchMaxItems, cfg.batchConcurrency
+	if maxItems <= 0 {
+		maxItems = defaultBatchMaxItems
+	}
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	ep := newBatchEndpoint(path)
+	ep.Register(m, func(ctx context.Context, items []batchItem) ([]batchResult, error) {
+		if len(items) > maxItems {
+			return nil, NewWireError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many calls in batch, at most %d are allowed.", maxItems))
+		}
+		outer := requestFromContext(ctx)
+		if cfg.verifier != nil {
+			ctx = context.WithValue(ctx, verifiedKey{}, true)
+		}
+		results := make([]batchResult, len(items))
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, it := range items {
+			sem <- struct{}{}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				results[i] = serveBatchItem(ctx, outer, path, h, i, it)
+			})
+		}
+		wg.Wait()
+		return results, nil
+	}, opts...)
+}
+
+// batchOnlyHeaders are the headers of batch requests that are not inherited by their calls.
+var batchOnlyHeaders = []string{
+	"Content-Length", "Content-Encoding", SignatureHeader, TimestampHeader,
+	TimeoutHeader, IdempotencyKeyHeader, MethodOverrideHeader,
+}
+
+// serveBatchItem serves the i-th call of a batch with h.
+func serveBatchItem(ctx context.Context, outer *http.Request, batchPath string, h http.Handler, i int, it batchItem) batchResult {
+	if p, _, _ := strings.Cut(it.Path, "?"); p == batchPath || !strings.HasPrefix(p, "/") {
+		return batchResult{Status: http.StatusBadRequest, Body: []byte("Invalid batch call path.")}
+	}
+	r, err := http.NewRequestWithContext(ctx, it.Method, it.Path, bytes.NewReader(it.Body))
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Body: []byte("Invalid batch call.")}
+	}
+	if outer != nil {
+		r.Header = outer.Header.Clone()
+		for _, k := range batchOnlyHeaders {
+			r.Header.Del(k)
+		}
+		if key := outer.Header.Get(IdempotencyKeyHeader); key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key+"."+strconv.Itoa(i))
+		}
+		r.Host = outer.Host
+		r.RemoteAddr = outer.RemoteAddr
+		r.TLS = outer.TLS
+	}
+	r.RequestURI = it.Path
+	r.Header.Set("Content-Type", it.ContentType)
+
+	w := &bufferedResponseWriter{header: http.Header{}}
+	h.ServeHTTP(w, r)
+	return batchResult{Status: w.statusCode(), ContentType: w.header.Get("Content-Type"), Body: w.buf.Bytes()}
+}
+
+// bufferedResponseWriter is a [http.ResponseWriter] that keeps the whole response in memory.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(buf)
+}
+
+// Flush implements [http.Flusher], it is a no-op since the whole response is kept in memory.
+func (w *bufferedResponseWriter) Flush() {}
+
+func (w *bufferedResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// ErrBatchPending is returned by [BatchResult.Get] before the batch was sent.
+var ErrBatchPending = errors.New("batch not sent yet")
+
+// Batch collects calls to send them in a single request to an endpoint registered with [RegisterBatch].
+//
+// Batches are not safe for concurrent use.
+type Batch struct {
+	conn  *Transport
+	ep    Endpoint[[]batchResult, []batchItem]
+	calls []batchCall
+}
+
+// batchCall is a call added to a Batch.
+type batchCall struct {
+	encode func(ctx context.Context) (batchItem, error)
+	decode func(ctx context.Context, res batchResult)
+	fail   func(err error)
+}
+
+// NewBatch creates a batch that is sent with conn to the batch endpoint at path.
+func NewBatch(conn *Transport, path string) *Batch {
+	return &Batch{conn: conn, ep: newBatchEndpoint(path)}
+}
+
+// BatchResult is the result of a call added to a [Batch].
+type BatchResult[Response any] struct {
+	resp Response
+	err  error
+}
+
+// Get returns the result of the call, it returns [ErrBatchPending] until the batch is sent.
+func (r *BatchResult[Response]) Get() (Response, error) {
+	return r.resp, r.err
+}
+
+// AddToBatch adds a call to e with req to b. The result is available once b is sent.
+//
+// Per-call options carried by the context passed to [Batch.Send], like [WithPathValue], apply to all calls.
+func AddToBatch[Response, Request any](b *Batch, e *Endpoint[Response, Request], req Request) *BatchResult[Response] {
+	res := &BatchResult[Response]{err: ErrBatchPending}
+	b.calls = append(b.calls, batchCall{
+		encode: func(ctx context.Context) (batchItem, error) {
+			streamUp, err := e.reqc.Co(ctx, req)
+			if err != nil {
+				return batchItem{}, fmt.Errorf("encoding request: %w", err)
+			}
+			if c, ok := streamUp.(io.Closer); ok && !e.reqc.KeepOpen {
+				defer func() { _ = c.Close() }()
+			}
+			hReq, err := e.newRequest(ctx, b.conn, streamUp)
+			if err != nil {
+				return batchItem{}, fmt.Errorf("converting request to HTTP: %w", err)
+			}
+			it := batchItem{Method: hReq.Method, Path: hReq.URL.RequestURI(), ContentType: contentTypeOf(streamUp, e.reqc.ContentType)}
+			if hReq.Body != nil {
+				if it.Body, err = io.ReadAll(hReq.Body); err != nil {
+					return batchItem{}, fmt.Errorf("encoding request: %w", err)
+				}
+			}
+			return it, nil
+		},
+		decode: func(ctx context.Context, br batchResult) {
+			hResp := &http.Response{
+				StatusCode: br.Status,
+				Header:     http.Header{"Content-Type": {br.ContentType}},
+				Body:       io.NopCloser(bytes.NewReader(br.Body)),
+			}
+			res.resp, res.err = e.decodeResponse(ctx, hResp)
+		},
+		fail: func(err error) { res.err = err },
+	})
+	return res
+}
+
+// Send sends all the calls added to the batch in a single request.
+//
+// It only returns an error if the batch request as a whole failed, in which case all calls fail
+// with the same error. Calls that could not be encoded fail individually.
+func (b *Batch) Send(ctx context.Context) error {
+	var (
+		items []batchItem
+		sent  []batchCall
+	)
+	for _, c := range b.calls {
+		it, err := c.encode(ctx)
+		if err != nil {
+			c.fail(err)
+			continue
+		}
+		items = append(items, it)
+		sent = append(sent, c)
+	}
+	b.calls = nil
+	if len(items) == 0 {
+		return nil
+	}
+
+	results, err := b.ep.Remote(b.conn)(ctx, items)
+	if err == nil && len(results) != len(sent) {
+		err = fmt.Errorf("batch: sent %d calls, got %d results", len(sent), len(results))
+	}
+	if err != nil {
+		for _, c := range sent {
+			c.fail(err)
+		}
+		return err
+	}
+	for i, c := range sent {
+		c.decode(ctx, results[i])
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	echo := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/echo")
+	echo.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "" {
+			return Resp{}, srpc.NotFound("nothing to echo")
+		}
+		return Resp{req.B}, nil
+	})
+	get := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/get/{id}")
+	get.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.PathValue(ctx, "id") + req.B}, nil
+	})
+	srpc.RegisterBatch(mux, "/batch", mux)
+
+	var requests int
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		mux.ServeHTTP(w, r)
+	})))(t)
+
+	b := srpc.NewBatch(conn, "/batch")
+	r1 := srpc.AddToBatch(b, &echo, Req{"one"})
+	r2 := srpc.AddToBatch(b, &echo, Req{})
+	r3 := srpc.AddToBatch(b, &get, Req{"!"})
+	_, err := r1.Get()
+	tst.Is(true, errors.Is(err, srpc.ErrBatchPending), t)
+
+	tst.No(b.Send(srpc.WithPathValue(ctx, "id", "42")), t)
+	tst.Is(1, requests, t)
+	got := tst.Do(r1.Get())(t)
+	tst.Is(Resp{"one"}, got, t)
+	_, err = r2.Get()
+	tst.Is(true, srpc.IsNotFound(err), t)
+	got = tst.Do(r3.Get())(t)
+	tst.Is(Resp{"42!"}, got, t)
+}
+
+func TestBatchLimits(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	var inflight, most atomic.Int32
+	echo := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/echo")
+	echo.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			if m := most.Load(); n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		return Resp{req.B}, nil
+	})
+	srpc.RegisterBatch(mux, "/batch", mux, srpc.WithBatchLimits(3, 2))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	b := srpc.NewBatch(conn, "/batch")
+	for range 3 {
+		srpc.AddToBatch(b, &echo, Req{"ok"})
+	}
+	tst.No(b.Send(ctx), t)
+	tst.Is(true, most.Load() <= 2, t)
+
+	for range 4 {
+		srpc.AddToBatch(b, &echo, Req{"ok"})
+	}
+	err := b.Send(ctx)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusRequestEntityTooLarge, werr.Code, t)
+}
+
+func TestBatchIdempotentSigned(t *testing.T) {
+	ctx := tst.Go(t)
+	key := []byte("shared secret")
+	verify := srpc.WithVerifier(srpc.HMACVerifier(key, time.Minute))
+	mux := http.NewServeMux()
+	var charges atomic.Int32
+	charge := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/charge")
+	charge.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B + strconv.Itoa(int(charges.Add(1)))}, nil
+	}, verify, srpc.WithIdempotency(srpc.NewMemoryIdempotencyStore(time.Hour, 100)))
+	srpc.RegisterBatch(mux, "/batch", mux, verify)
+
+	send := func(conn *srpc.Transport) ([]Resp, error) {
+		b := srpc.NewBatch(conn, "/batch")
+		rs := []*srpc.BatchResult[Resp]{
+			srpc.AddToBatch(b, &charge, Req{"a"}),
+			srpc.AddToBatch(b, &charge, Req{"b"}),
+		}
+		if err := b.Send(srpc.WithIdempotencyKey(ctx, "key")); err != nil {
+			return nil, err
+		}
+		var got []Resp
+		for _, r := range rs {
+			resp, err := r.Get()
+			if err != nil {
+				return nil, err
+			}
+			got = append(got, resp)
+		}
+		return got, nil
+	}
+
+	conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithSigner(srpc.HMACSigner(key))))(t)
+	first := tst.Do(send(conn))(t)
+	tst.Is(2, int(charges.Load()), t)
+	tst.Is(true, first[0] != first[1], t)
+	// A retried batch replays its calls.
+	second := tst.Do(send(conn))(t)
+	tst.Is(first, second, t)
+	tst.Is(2, int(charges.Load()), t)
+
+	unsigned := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	_, err := send(unsigned)
+	tst.Is(true, srpc.IsUnauthorized(err), t)
+}
@@ -0,0 +1,121 @@
+package srpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// maxLoggedBody is the maximum number of bytes of each body logged by [WithBodyLogging].
+const maxLoggedBody = 64 * 1024
+
+// BodyRedactor returns a copy of the body, with the given Content-Type, with sensitive data removed.
+type BodyRedactor func(contentType string, body []byte) []byte
+
+// WithBodyLogging makes endpoints log the encoded request and response bodies at debug level,
+// after applying redact, if it's not nil.
+//
+// Bodies are captured while they are read and written, up to 64KiB each, so decoding and streaming are unaffected.
+// Since it has a cost and bodies might carry sensitive data it's meant to be enabled on single endpoints,
+// to debug integrations.
+func WithBodyLogging(redact BodyRedactor) ServerOption {
+	return func(c *serverConfig) {
+		c.logBodies = true
+		c.redact = redact
+	}
+}
+
+// RedactJSONFields returns a [BodyRedactor] that replaces the values of the named fields of JSON objects,
+// at any depth, with "[REDACTED]". Bodies that are not valid JSON are replaced entirely.
+func RedactJSONFields(fields ...string) BodyRedactor {
+	return func(_ string, body []byte) []byte {
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return []byte("[REDACTED]")
+		}
+		buf, err := json.Marshal(redactJSON(v, fields))
+		if err != nil {
+			return []byte("[REDACTED]")
+		}
+		return buf
+	}
+}
+
+func redactJSON(v any, fields []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, fv := range v {
+			if slices.Contains(fields, k) {
+				v[k] = "[REDACTED]"
+				continue
+			}
+			v[k] = redactJSON(fv, fields)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSON(e, fields)
+		}
+	}
+	return v
+}
+
+// capBuffer keeps the first bytes written to it, up to its limit, and discards the rest.
+type capBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *capBuffer) Write(p []byte) (int, error) {
+	if room := maxLoggedBody - b.Len(); len(p) > room {
+		b.truncated = true
+		_, _ = b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// logged returns the captured body, redacted with redact.
+func (b *capBuffer) logged(contentType string, redact BodyRedactor) string {
+	body := b.Bytes()
+	if redact != nil {
+		body = redact(contentType, body)
+	}
+	if b.truncated {
+		return string(body) + "...[truncated]"
+	}
+	return string(body)
+}
+
+// teeReader is a request body that copies what is read to buf.
+type teeReader struct {
+	io.ReadCloser
+	buf io.Writer
+}
+
+func (r *teeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	_, _ = r.buf.Write(p[:n])
+	return n, err
+}
+
+// teeResponseWriter is a [http.ResponseWriter] that copies the body to buf.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	buf *capBuffer
+}
+
+func (w *teeResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	_, _ = w.buf.Write(p[:n])
+	return n, err
+}
+
+// Flush implements [http.Flusher].
+func (w *teeResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows [http.ResponseController] to access the underlying writer.
+func (w *teeResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
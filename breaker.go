@@ -0,0 +1,153 @@
+package srpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by calls that are rejected without being issued
+// because the circuit breaker of the [Transport] is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// States of a circuit breaker.
+const (
+	// CircuitClosed lets all calls through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls with [ErrCircuitOpen].
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe call through to check whether the server recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreaker configures the circuit breaker of a [Transport].
+//
+// Requests that can't be issued, including the ones that time out because of the Timeout of the
+// [http.Client], and responses with a 5xx status are failures, all other responses are successes.
+// Calls canceled by the caller, or whose context expired, are neither.
+//
+// After Threshold consecutive failures the circuit opens and calls fail immediately with
+// [ErrCircuitOpen] for the Cooldown period. Then a single probe call is let through:
+// if it succeeds the circuit closes, otherwise it opens again for another Cooldown.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures that open the circuit.
+	Threshold int
+	// Cooldown is how long the circuit stays open before letting a probe through.
+	Cooldown time.Duration
+	// OnStateChange, if not nil, is called on every state transition.
+	//
+	// It is called synchronously by the call that caused the transition, so it should not block.
+	OnStateChange func(from, to CircuitState)
+}
+
+// WithCircuitBreaker makes the [Transport] stop issuing calls while the server keeps failing, according to cb.
+//
+// The breaker is per transport, so it is shared by all the endpoints that use it.
+// When combined with [WithRetry], every attempt counts.
+func WithCircuitBreaker(cb CircuitBreaker) TransportOption {
+	return func(t *Transport) {
+		t.breaker = &breaker{cfg: cb}
+	}
+}
+
+// breaker is the state of a [CircuitBreaker].
+type breaker struct {
+	cfg CircuitBreaker
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a call can be issued, and whether it is the probe of a half-open circuit.
+//
+// Calls that are allowed must be followed by exactly one call to done.
+func (b *breaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false, ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+	case CircuitClosed:
+		return false, nil
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done records the outcome of a call that was allowed, probe is the one returned by allow.
+//
+// If counted is false the call neither succeeded nor failed, for example because it was canceled.
+func (b *breaker) done(probe, counted, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case !counted:
+	case !failed && probe:
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.setState(CircuitClosed)
+		}
+	case !failed:
+		// Successes of calls that were issued before the circuit opened don't close it.
+		if b.state == CircuitClosed {
+			b.failures = 0
+		}
+	case probe:
+		b.open()
+	case b.state == CircuitClosed:
+		b.failures++
+		if b.failures >= b.cfg.Threshold {
+			b.open()
+		}
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *breaker) setState(s CircuitState) {
+	from := b.state
+	b.state = s
+	b.probing = false
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, s)
+	}
+}
@@ -0,0 +1,99 @@
+package srpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// WithTrustedProxies makes endpoints determine the IP of clients with [ClientIP], trusting the forwarding
+// header set by proxies in the given ranges, for example the load balancers in front of the server.
+//
+// header must be the one the proxies set, or overwrite, like "Forwarded" or "X-Forwarded-For":
+// other forwarding headers are ignored, as clients can forge them.
+//
+// The IP is available to procedures, authenticators and middleware via [ClientIPFromContext],
+// and it is logged by [WithAccessLog]. srpc has no rate limiter: middleware that limits
+// requests by client should use [ClientIPFromContext].
+func WithTrustedProxies(header string, proxies ...netip.Prefix) ServerOption {
+	return func(c *serverConfig) {
+		c.forwardedHeader = http.CanonicalHeaderKey(header)
+		c.trustedProxies = proxies
+	}
+}
+
+// ClientIPFromContext returns the IP of the client that sent the request being served,
+// determined as described in [WithTrustedProxies], or the zero address outside of served procedures.
+func ClientIPFromContext(ctx context.Context) netip.Addr {
+	ip, _ := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip
+}
+
+// ClientIP returns the IP of the client that sent r, reading the forwarding header only if the request
+// comes from one of the trusted proxies. The Forwarded header is parsed as described in RFC 7239,
+// other headers, like X-Forwarded-For, as lists of comma-separated addresses.
+//
+// The addresses in the header are read from the last one, which was added by the nearest proxy,
+// and the first one that is not trusted is returned: addresses added before it might have been forged by the client.
+// If the header holds something other than an address, the last trusted hop is returned.
+// The zero address is returned if RemoteAddr is not an IP, for example for unix domain sockets.
+func ClientIP(r *http.Request, header string, trusted []netip.Prefix) netip.Addr {
+	ip := parseIP(r.RemoteAddr)
+	if !ip.IsValid() {
+		return ip
+	}
+	hops := forwardedFor(r.Header, header)
+	for len(hops) > 0 && isTrusted(ip, trusted) {
+		next := parseIP(hops[len(hops)-1])
+		if !next.IsValid() {
+			break
+		}
+		ip, hops = next, hops[:len(hops)-1]
+	}
+	return ip
+}
+
+// isTrusted reports whether ip is in one of the trusted ranges.
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	return slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(ip) })
+}
+
+// forwardedFor returns the addresses of the hops a request went through, from the client to the nearest proxy,
+// as listed in the header.
+func forwardedFor(h http.Header, header string) []string {
+	var hops []string
+	if fwd := h.Values(header); len(fwd) > 0 && http.CanonicalHeaderKey(header) == "Forwarded" {
+		for elem := range strings.SplitSeq(strings.Join(fwd, ","), ",") {
+			var hop string
+			for pair := range strings.SplitSeq(elem, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(k, "for") {
+					hop = strings.Trim(v, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+	for _, v := range h.Values(header) {
+		for hop := range strings.SplitSeq(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseIP parses an IP address, optionally with a port and with IPv6 addresses in brackets.
+func parseIP(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	ip, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
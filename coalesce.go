@@ -0,0 +1,148 @@
+package srpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithCoalescing makes the transport coalesce concurrent identical calls to GET and HEAD endpoints:
+// calls with the same URL and per-call headers that are issued while one is in flight wait for it,
+// and all receive the same response or error.
+//
+// Responses are shared, not copied, so callers must not modify them. Endpoints with streamed responses
+// are never coalesced. Metrics are reported once per call that is actually issued.
+//
+// The shared call is canceled only when all the callers waiting for it gave up, and has the deadline of
+// the caller that issued it: calls with a later deadline, or without one, are not coalesced with it. Calls are told apart
+// by what they send, not by their context, so they are never coalesced if the transport has options
+// that prepare requests from the context, like [WithTokenProvider], [WithClientPropagators] or [WithSigner],
+// or if their context asks for the response with [WithResponseInfo] or [WithResponseHook].
+func WithCoalescing() TransportOption {
+	return func(t *Transport) { t.coalesce = true }
+}
+
+// coalesced returns the remote procedure that shares in-flight calls.
+func (e *Endpoint[Response, Request]) coalesced(conn *Transport) Procedure[Response, Request] {
+	call := e.call(conn)
+	return func(ctx context.Context, req Request) (Response, error) {
+		key, ok := e.flightKey(ctx, conn, req)
+		if !ok {
+			return call(ctx, req)
+		}
+		v, err := conn.flights.do(ctx, key, func(ctx context.Context) (any, error) {
+			return call(ctx, req)
+		})
+		resp, _ := v.(Response)
+		return resp, err
+	}
+}
+
+// flightKey returns the key that identifies identical calls, and false if the call should not be coalesced.
+func (e *Endpoint[Response, Request]) flightKey(ctx context.Context, conn *Transport, req Request) (string, bool) {
+	// Prepare hooks can add headers that depend on the context, which are not part of the key.
+	if opts := callOptionsFromContext(ctx); opts.hook != nil || opts.info != nil || len(conn.prepareHooks()) > 0 {
+		return "", false
+	}
+	streamUp, err := e.reqc.Co(ctx, req)
+	if err != nil {
+		return "", false
+	}
+	if c, ok := streamUp.(io.Closer); ok {
+		defer func() { _ = c.Close() }()
+	}
+	hReq, err := e.newRequest(ctx, conn, streamUp)
+	if err != nil || hReq.Method != e.method {
+		return "", false
+	}
+	var key strings.Builder
+	key.WriteString(hReq.Method + " " + hReq.URL.String() + "\n")
+	opts := callOptionsFromContext(ctx)
+	if err := opts.header.Write(&key); err != nil {
+		return "", false
+	}
+	for _, c := range opts.cookies {
+		key.WriteString("Cookie: " + c.String() + "\n")
+	}
+	return key.String(), true
+}
+
+// flightGroup tracks the calls in flight, by key.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a call in flight, the result is available once done is closed.
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// deadline is the deadline of the call, it is zero if the call has none.
+	deadline time.Time
+
+	val any
+	err error
+}
+
+// do calls fn, unless a call with the same key is in flight, and returns its result.
+//
+// fn is called with a context that has the values and the deadline of ctx, and is canceled once all
+// the callers waiting for the result are done. Callers whose deadline is later than the one of the call
+// in flight call fn on their own.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	deadline, _ := ctx.Deadline()
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if ok && !f.deadline.IsZero() && (deadline.IsZero() || deadline.After(f.deadline)) {
+		g.mu.Unlock()
+		return fn(ctx)
+	}
+	if !ok {
+		var (
+			fctx   = context.WithoutCancel(ctx)
+			cancel context.CancelFunc
+		)
+		if deadline.IsZero() {
+			fctx, cancel = context.WithCancel(fctx)
+		} else {
+			fctx, cancel = context.WithDeadline(fctx, deadline)
+		}
+		f = &flight{done: make(chan struct{}), cancel: cancel, deadline: deadline}
+		if g.flights == nil {
+			g.flights = map[string]*flight{}
+		}
+		g.flights[key] = f
+		go func() {
+			defer cancel()
+			f.val, f.err = fn(fctx)
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.flights[key] == f {
+				// Callers that come after this point start a new call.
+				delete(g.flights, key)
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
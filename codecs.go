@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"iter"
+	"mime"
 	"net/http"
+	"sync"
 	"sync/atomic"
 )
 
@@ -27,8 +31,18 @@ func (empty) Read(_ []byte) (n int, err error) { return 0, io.EOF }
 //	got == value
 //
 // Should be true for every possible value of T.
+//
+// On the server side the context passed to Co, CoTo and Dec is the one of the procedure: it carries
+// the values of the request context, set for example by HTTP middleware, and the ones added by
+// the [Authenticator]. This allows codecs to shape messages for each caller, for example to mask fields.
+// On the client side it is the context of the call.
 type Codec[T any] struct {
 	// ContentType is the HTTP Content-Type header to use for responses.
+	//
+	// Clients accept responses with the same media type, regardless of parameters like charset.
+	//
+	// If empty, the Content-Type is chosen for each message by the reader returned by Co,
+	// which implements [ContentTyper], and clients accept responses with any Content-Type.
 	ContentType string
 	// KeepOpen tells this library to not close streams after client calls return.
 	KeepOpen bool
@@ -36,15 +50,125 @@ type Codec[T any] struct {
 	//
 	// Implementers have the guarantee that the returned reader will be copied with
 	// io.Copy to the response writer, or used as request body/query on the client side.
+	//
+	// Request bodies of state-changing endpoints are streamed, not buffered: readers produced
+	// lazily are sent with chunked transfer encoding unless their length is known upfront,
+	// which is only the case for [*bytes.Reader], [*bytes.Buffer] and [*strings.Reader].
 	Co func(ctx context.Context, t T) (io.Reader, error)
+	// CoTo optionally encodes the given value directly to w, which avoids buffering it.
+	//
+	// If set, servers use it instead of Co to send responses, while Co is still used for requests.
+	// If CoTo fails before writing, servers respond with 500 Internal Server Error as they do when Co fails,
+	// otherwise the response is truncated, and the error reported in the trailers if KeepOpen is set.
+	CoTo func(ctx context.Context, w io.Writer, t T) error
 	// Dec decodes data from a stream.
+	//
+	// The Content-Type of the message being decoded is available via [ContentTypeFromContext].
 	Dec func(ctx context.Context, r io.Reader) (T, error)
 }
 
+// encoderTo is the stream of a response encoded with [Codec.CoTo].
+type encoderTo struct {
+	encode func(w io.Writer) error
+}
+
+func (e encoderTo) Read([]byte) (int, error) {
+	return 0, errors.New("streams of Codec.CoTo should only be used in io.Copy")
+}
+
+// WriteTo implements [io.WriterTo].
+func (e encoderTo) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := e.encode(cw)
+	return cw.n, err
+}
+
+func (encoderTo) stopsWithContext() {}
+
+// ContentTyper can be implemented by the readers returned by [Codec.Co] to override
+// the codec ContentType for a single message.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// contentTypeOf returns the Content-Type of the encoded message r.
+func contentTypeOf(r io.Reader, fallback string) string {
+	if ct, ok := r.(ContentTyper); ok {
+		return ct.ContentType()
+	}
+	return fallback
+}
+
+// RoundTrip encodes v with c and decodes the result, as it would happen if v was sent over the wire.
+//
+// It is meant to test codecs: the encoded message is copied to an in-memory buffer, as servers do with responses,
+// and the encoded stream is closed before decoding.
+func RoundTrip[T any](ctx context.Context, c Codec[T], v T) (T, error) {
+	var zero T
+	r, err := c.Co(ctx, v)
+	if err != nil {
+		return zero, fmt.Errorf("encoding: %w", err)
+	}
+	w := &bufferedResponseWriter{header: http.Header{}}
+	_, err = copyContext(ctx, w, r)
+	if cl, ok := r.(io.Closer); ok {
+		err = errors.Join(err, cl.Close())
+	}
+	if err != nil {
+		return zero, fmt.Errorf("encoding: %w", err)
+	}
+	got, err := c.Dec(withContentType(ctx, contentTypeOf(r, c.ContentType)), io.NopCloser(&w.buf))
+	if err != nil {
+		return zero, fmt.Errorf("decoding: %w", err)
+	}
+	return got, nil
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// sameMediaType reports whether the two Content-Type values have the same media type,
+// ignoring parameters. An empty Content-Type matches any, as the media type is not known.
+func sameMediaType(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	ma, _, err := mime.ParseMediaType(a)
+	if err != nil {
+		return false
+	}
+	mb, _, err := mime.ParseMediaType(b)
+	if err != nil {
+		return false
+	}
+	return ma == mb
+}
+
 // JSON
 
 // NewCodecJSON creates a new Codec that uses JSON as wire format.
 func NewCodecJSON[T any]() Codec[T] {
+	return newCodecJSON[T](false)
+}
+
+// NewCodecJSONStrict is like [NewCodecJSON], but decoding fails for objects with fields
+// that don't match any exported field of the destination.
+//
+// It can be used as request codec to catch client mistakes, like typos in field names.
+func NewCodecJSONStrict[T any]() Codec[T] {
+	return newCodecJSON[T](true)
+}
+
+func newCodecJSON[T any](strict bool) Codec[T] {
 	var zero T
 	_, isEmpty := any(zero).(struct{})
 	return Codec[T]{
@@ -64,11 +188,557 @@ func NewCodecJSON[T any]() Codec[T] {
 			if isEmpty {
 				return zero, nil
 			}
-			return t, json.NewDecoder(r).Decode(&t)
+			dec := json.NewDecoder(r)
+			if strict {
+				dec.DisallowUnknownFields()
+			}
+			return t, dec.Decode(&t)
+		},
+	}
+}
+
+// maxPooledBuffer is the capacity above which buffers used by [NewCodecJSONPooled] are not reused,
+// so that a few large messages don't keep memory allocated.
+const maxPooledBuffer = 64 * 1024
+
+// jsonBuffer is a buffer with an encoder that writes to it, kept in jsonBuffers.
+type jsonBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonBuffers = sync.Pool{New: func() any {
+	b := &jsonBuffer{}
+	b.enc = json.NewEncoder(&b.Buffer)
+	return b
+}}
+
+// NewCodecJSONPooled is like [NewCodecJSON], but it encodes messages into buffers taken from a pool,
+// which reduces allocations for services that handle many requests.
+//
+// Encoded messages are readers that return their buffer to the pool when closed, which servers do once
+// the response is sent: callers of Co must close them and must not use them afterwards.
+// Clients copy requests before sending them, so only servers benefit from the pool.
+func NewCodecJSONPooled[T any]() Codec[T] {
+	c := newCodecJSON[T](false)
+	co := c.Co
+	c.Co = func(ctx context.Context, t T) (io.Reader, error) {
+		var zero T
+		if _, ok := any(zero).(struct{}); ok {
+			return co(ctx, t)
+		}
+		buf, _ := jsonBuffers.Get().(*jsonBuffer)
+		buf.Reset()
+		if err := buf.enc.Encode(t); err != nil {
+			putJSONBuffer(buf)
+			return nil, err
+		}
+		// Drop the newline added by the encoder, to send the same bytes as [json.Marshal].
+		buf.Truncate(buf.Len() - 1)
+		r := &pooledReader{buf: buf}
+		r.Reset(buf.Bytes())
+		return r, nil
+	}
+	return c
+}
+
+func putJSONBuffer(buf *jsonBuffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		jsonBuffers.Put(buf)
+	}
+}
+
+// pooledReader reads a message encoded in a pooled buffer, which is returned to the pool on Close.
+type pooledReader struct {
+	bytes.Reader
+	buf  *jsonBuffer
+	once sync.Once
+}
+
+// Close returns the buffer to the pool, the reader is empty afterwards.
+func (r *pooledReader) Close() error {
+	r.once.Do(func() {
+		r.Reset(nil)
+		putJSONBuffer(r.buf)
+		r.buf = nil
+	})
+	return nil
+}
+
+// NewCodecCanonicalJSON is like [NewCodecJSON], but it encodes values in a canonical form:
+// object keys are sorted, there is no insignificant whitespace and characters are not HTML-escaped.
+//
+// Equal values always have the same encoding, which makes it suitable for signatures and ETags.
+// Encoding is slower than with [NewCodecJSON], as values are marshaled twice.
+func NewCodecCanonicalJSON[T any]() Codec[T] {
+	c := newCodecJSON[T](false)
+	co := c.Co
+	c.Co = func(ctx context.Context, t T) (io.Reader, error) {
+		r, err := co(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.(empty); ok {
+			return r, nil
+		}
+		buf, err := canonicalJSON(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(buf), nil
+	}
+	return c
+}
+
+// canonicalJSON re-encodes the JSON value read from r in canonical form.
+func canonicalJSON(r io.Reader) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// XML
+
+// NewCodecXML creates a new Codec that uses XML as wire format.
+func NewCodecXML[T any]() Codec[T] {
+	var zero T
+	_, isEmpty := any(zero).(struct{})
+	c := Codec[T]{
+		ContentType: "application/xml",
+		Co: func(_ context.Context, t T) (io.Reader, error) {
+			if isEmpty {
+				return empty{}, nil
+			}
+
+			buf, err := xml.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(buf), nil
+		},
+		Dec: func(_ context.Context, r io.Reader) (t T, err error) {
+			if isEmpty {
+				return zero, nil
+			}
+			return t, xml.NewDecoder(r).Decode(&t)
+		},
+	}
+	if !isEmpty {
+		// The XML encoder writes while it encodes, so responses don't need to be buffered.
+		c.CoTo = func(_ context.Context, w io.Writer, t T) error {
+			return xml.NewEncoder(w).Encode(t)
+		}
+	}
+	return c
+}
+
+// Reader
+
+// NewCodecReader creates a Codec that passes streams through without encoding them.
+//
+// On the server side the returned reader is copied to the response and then closed,
+// so it can be used to serve large files without buffering them.
+// Procedures can set the Content-Length or Content-Disposition headers with
+// [ResponseHeader] or [Attachment].
+//
+// On the client side the response body is returned as is: callers must close it.
+//
+// If contentType is empty the Content-Type is the one set by the procedure with [ResponseHeader],
+// see [NewCodecReaderSniff] to detect it when the procedure doesn't set one.
+// Clients accept any Content-Type.
+func NewCodecReader(contentType string) Codec[io.ReadCloser] {
+	return newCodecReader(contentType, false)
+}
+
+// NewCodecReaderSniff is like [NewCodecReader] with an empty Content-Type, but if the procedure
+// doesn't set one it is detected by [http.DetectContentType] from the start of the stream.
+//
+// Detection waits for the first 512 bytes of the stream, or for its end, before sending anything,
+// so it is not suited for slow streams.
+func NewCodecReaderSniff() Codec[io.ReadCloser] {
+	return newCodecReader("", true)
+}
+
+func newCodecReader(contentType string, sniff bool) Codec[io.ReadCloser] {
+	return Codec[io.ReadCloser]{
+		ContentType: contentType,
+		KeepOpen:    true,
+		Co: func(ctx context.Context, rc io.ReadCloser) (io.Reader, error) {
+			if rc == nil {
+				return empty{}, nil
+			}
+			if sniff {
+				return sniffContentType(ctx, rc)
+			}
+			return rc, nil
+		},
+		Dec: func(_ context.Context, r io.Reader) (io.ReadCloser, error) {
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return io.NopCloser(r), nil
+		},
+	}
+}
+
+// sniffLen is the number of bytes [http.DetectContentType] looks at.
+const sniffLen = 512
+
+// sniffContentType returns rc with the Content-Type set by the procedure, or detected from its first bytes.
+func sniffContentType(ctx context.Context, rc io.ReadCloser) (io.Reader, error) {
+	if _, ok := rc.(ContentTyper); ok {
+		return rc, nil
+	}
+	if ct := ResponseHeader(ctx).Get("Content-Type"); ct != "" {
+		return contentTypeReader{ReadCloser: rc, contentType: ct}, nil
+	}
+	br := bufio.NewReaderSize(rc, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("sniffing content type: %w", err)
+	}
+	body := struct {
+		io.Reader
+		io.Closer
+	}{br, rc}
+	return contentTypeReader{ReadCloser: body, contentType: http.DetectContentType(head)}, nil
+}
+
+// copyBufSize is the size of the buffer used by copyContext.
+const copyBufSize = 32 * 1024
+
+// contextWriterTo is implemented by the streams of this package that stop writing on their own
+// when the context they were created with is done.
+type contextWriterTo interface {
+	io.WriterTo
+	stopsWithContext()
+}
+
+// copyContext is like [io.Copy], but stops as soon as ctx is done.
+//
+// Streams of this package that implement [io.WriterTo] are in charge of the copy, since they
+// stop on their own when ctx is done or when writing fails. Other sources, like [*os.File],
+// are read in chunks, so that the copy is not stopped only by the end of the source.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	if wt, ok := src.(contextWriterTo); ok {
+		return wt.WriteTo(dst)
+	}
+	var (
+		n   int64
+		buf = make([]byte, copyBufSize)
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+			if nw != nr {
+				return n, io.ErrShortWrite
+			}
+		}
+		if errors.Is(rerr, io.EOF) {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// RawBody is a request body that is read incrementally, as it is received.
+//
+// Its first bytes are buffered, so they can be inspected with Peek before deciding how to read the rest.
+type RawBody struct {
+	r           *bufio.Reader
+	c           io.Closer
+	contentType string
+}
+
+// NewRawBody returns a [RawBody] that sends r with the given Content-Type.
+//
+// If contentType is empty the one of the codec is used.
+func NewRawBody(r io.Reader, contentType string) *RawBody {
+	c, _ := r.(io.Closer)
+	return &RawBody{r: bufio.NewReader(r), c: c, contentType: contentType}
+}
+
+// Read implements [io.Reader].
+func (b *RawBody) Read(p []byte) (int, error) { return b.r.Read(p) }
+
+// Peek returns the next n bytes without consuming them.
+//
+// Peeking more bytes than the buffer size of the codec fails with [bufio.ErrBufferFull].
+// If the body is shorter than n bytes, Peek returns what is available and [io.EOF].
+func (b *RawBody) Peek(n int) ([]byte, error) { return b.r.Peek(n) }
+
+// ContentType returns the Content-Type of the body.
+func (b *RawBody) ContentType() string { return b.contentType }
+
+// Close closes the underlying stream, if it is an [io.Closer].
+func (b *RawBody) Close() error {
+	if b.c == nil {
+		return nil
+	}
+	return b.c.Close()
+}
+
+// NewCodecRawBody creates a request Codec that passes the body to procedures as a stream
+// instead of decoding it, so that large uploads can be processed without holding them in memory.
+//
+// Up to bufSize bytes of the body can be inspected with [RawBody.Peek] before reading it,
+// for example to sniff its type from its magic number.
+//
+// The decoded body carries the request Content-Type, which servers check against contentType
+// only if [WithStrictContentType] is used.
+func NewCodecRawBody(contentType string, bufSize int) Codec[*RawBody] {
+	return Codec[*RawBody]{
+		ContentType: contentType,
+		Co: func(_ context.Context, b *RawBody) (io.Reader, error) {
+			if b == nil {
+				return empty{}, nil
+			}
+			ct := b.contentType
+			if ct == "" {
+				ct = contentType
+			}
+			return contentTypeReader{ReadCloser: b, contentType: ct}, nil
+		},
+		Dec: func(ctx context.Context, r io.Reader) (*RawBody, error) {
+			c, _ := r.(io.Closer)
+			return &RawBody{r: bufio.NewReaderSize(r, bufSize), c: c, contentType: ContentTypeFromContext(ctx)}, nil
+		},
+	}
+}
+
+// Payload is a message whose Content-Type is chosen at runtime, for example by procedures that
+// can respond in different formats.
+type Payload struct {
+	ContentType string
+	Body        io.ReadCloser
+}
+
+// NewCodecPayload creates a Codec that sends the body of a [Payload] verbatim, with its Content-Type.
+//
+// Decoded payloads carry the Content-Type of the message. As with [NewCodecReader], on the
+// client side the body is returned as is: callers must close it.
+func NewCodecPayload() Codec[Payload] {
+	return Codec[Payload]{
+		KeepOpen: true,
+		Co: func(_ context.Context, p Payload) (io.Reader, error) {
+			if p.Body == nil {
+				return empty{}, nil
+			}
+			return contentTypeReader{ReadCloser: p.Body, contentType: p.ContentType}, nil
+		},
+		Dec: func(ctx context.Context, r io.Reader) (Payload, error) {
+			rc, ok := r.(io.ReadCloser)
+			if !ok {
+				rc = io.NopCloser(r)
+			}
+			return Payload{ContentType: ContentTypeFromContext(ctx), Body: rc}, nil
+		},
+	}
+}
+
+// Encoded is a value together with its encoding, which is sent as is by [NewCodecEncoded].
+//
+// It allows procedures to cache the encoded form of responses that change rarely,
+// instead of encoding them for every request.
+type Encoded[T any] struct {
+	value       T
+	buf         []byte
+	contentType string
+}
+
+// Encode encodes v with c, for example to cache it.
+//
+// It should only be used with codecs that produce the whole message when encoding,
+// not with the ones of streams.
+func Encode[T any](ctx context.Context, c Codec[T], v T) (Encoded[T], error) {
+	r, err := c.Co(ctx, v)
+	if err != nil {
+		return Encoded[T]{}, err
+	}
+	if cl, ok := r.(io.Closer); ok {
+		defer func() { _ = cl.Close() }()
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return Encoded[T]{}, err
+	}
+	return Encoded[T]{value: v, buf: buf, contentType: contentTypeOf(r, c.ContentType)}, nil
+}
+
+// Value returns the encoded value.
+func (e Encoded[T]) Value() T { return e.value }
+
+// Bytes returns the encoding of the value, it is nil for values that were decoded.
+func (e Encoded[T]) Bytes() []byte { return e.buf }
+
+// NewCodecEncoded creates a Codec for values encoded with [Encode] using c.
+//
+// Encoded values are sent without encoding them again, and zero values are encoded with c.
+// Messages are decoded with c, so clients receive the value.
+func NewCodecEncoded[T any](c Codec[T]) Codec[Encoded[T]] {
+	return Codec[Encoded[T]]{
+		ContentType: c.ContentType,
+		Co: func(ctx context.Context, e Encoded[T]) (io.Reader, error) {
+			if e.buf == nil {
+				return c.Co(ctx, e.value)
+			}
+			return contentTypeReader{ReadCloser: io.NopCloser(bytes.NewReader(e.buf)), contentType: e.contentType}, nil
+		},
+		Dec: func(ctx context.Context, r io.Reader) (Encoded[T], error) {
+			v, err := c.Dec(ctx, r)
+			return Encoded[T]{value: v}, err
+		},
+	}
+}
+
+// NewCodecFallback creates a Codec that encodes with primary and decodes with primary or, if that fails,
+// with secondary. It allows servers to accept two versions of a message while clients migrate.
+//
+// Messages are buffered in memory to be decoded again, so it must not be used with streaming codecs.
+// If both codecs fail the zero value and the error of primary are returned.
+func NewCodecFallback[T any](primary, secondary Codec[T]) Codec[T] {
+	c := primary
+	c.Dec = func(ctx context.Context, r io.Reader) (T, error) {
+		var zero T
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return zero, err
+		}
+		t, err := primary.Dec(ctx, bytes.NewReader(buf))
+		if err == nil {
+			return t, nil
+		}
+		if t, err := secondary.Dec(ctx, bytes.NewReader(buf)); err == nil {
+			return t, nil
+		}
+		return zero, err
+	}
+	return c
+}
+
+// Stream
+
+const (
+	streamContentType = "application/x-srpc-stream"
+	// streamPrefixLen is the length of the big-endian size that precedes every stream frame.
+	streamPrefixLen = 4
+	// maxFrameSize is the maximum size of a single stream frame.
+	maxFrameSize = 1024 * 1024
+)
+
+// NewCodecStream constructs a codec for sequences of values encoded as length-prefixed JSON frames.
+//
+// Values are encoded lazily while the stream is sent, so it can be used to upload data that
+// is produced incrementally: requests of state-changing endpoints are sent with chunked transfer encoding.
+// If the encoded sequence yields an error, sending is aborted.
+//
+// Decoded sequences read from the underlying stream while they are iterated, so servers must
+// consume them before their procedure returns.
+func NewCodecStream[T any]() Codec[iter.Seq2[T, error]] {
+	return Codec[iter.Seq2[T, error]]{
+		ContentType: streamContentType,
+		KeepOpen:    true,
+		Co: func(ctx context.Context, seq iter.Seq2[T, error]) (io.Reader, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				_ = pw.CloseWithError(writeFrames(ctx, pw, seq))
+			}()
+			return pr, nil
+		},
+		Dec: func(_ context.Context, r io.Reader) (iter.Seq2[T, error], error) {
+			return func(yield func(T, error) bool) {
+				defer func() {
+					if c, ok := r.(io.Closer); ok {
+						_ = c.Close()
+					}
+				}()
+				var (
+					zero   T
+					prefix [streamPrefixLen]byte
+				)
+				for {
+					if _, err := io.ReadFull(r, prefix[:]); err != nil {
+						if !errors.Is(err, io.EOF) {
+							yield(zero, fmt.Errorf("reading frame size: %w", err))
+						}
+						return
+					}
+					size := binary.BigEndian.Uint32(prefix[:])
+					if size > maxFrameSize {
+						yield(zero, fmt.Errorf("frame of %d bytes exceeds the maximum size", size))
+						return
+					}
+					buf := make([]byte, size)
+					if _, err := io.ReadFull(r, buf); err != nil {
+						yield(zero, fmt.Errorf("reading frame: %w", err))
+						return
+					}
+					var t T
+					if err := json.Unmarshal(buf, &t); err != nil {
+						if !yield(zero, err) {
+							return
+						}
+						continue
+					}
+					if !yield(t, nil) {
+						return
+					}
+				}
+			}, nil
 		},
 	}
 }
 
+func writeFrames[T any](ctx context.Context, w io.Writer, seq iter.Seq2[T, error]) error {
+	if seq == nil {
+		return nil
+	}
+	var prefix [streamPrefixLen]byte
+	for v, err := range seq {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if len(buf) > maxFrameSize {
+			return fmt.Errorf("frame of %d bytes exceeds the maximum size", len(buf))
+		}
+		binary.BigEndian.PutUint32(prefix[:], uint32(len(buf))) //nolint: gosec // bounded by maxFrameSize.
+		if _, err := w.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Seq
 
 const (
@@ -77,6 +747,7 @@ const (
 )
 
 type wireSeq[T any] struct {
+	ctx    context.Context //nolint: containedctx // the sequence is consumed within the request lifetime.
 	seq    iter.Seq2[T, error]
 	closed atomic.Bool
 }
@@ -95,6 +766,8 @@ type writeFlusher interface {
 	http.Flusher
 }
 
+func (*wireSeq[T]) stopsWithContext() {}
+
 func (i *wireSeq[T]) WriteTo(baseWriter io.Writer) (int64, error) {
 	w, ok := baseWriter.(writeFlusher)
 	if !ok {
@@ -114,23 +787,38 @@ func (i *wireSeq[T]) WriteTo(baseWriter io.Writer) (int64, error) {
 		enc = json.NewEncoder(&buf)
 	)
 
+	p := startPinger(i.ctx, w, keepAliveFromContext(i.ctx))
+	defer p.stop()
 	for v, seqErr := range i.seq {
 		if i.closed.Load() {
 			return n, io.EOF
 		}
-		n, err = i.writeKind(w, n, seqErr != nil)
-		if err != nil {
+		if err := i.ctx.Err(); err != nil {
 			return n, err
 		}
-		n, err = i.writeMessage(w, n, v, seqErr, &buf, enc)
+		p.lock()
+		n, err = i.writeEvent(w, n, v, seqErr, &buf, enc)
+		p.unlock()
 		if err != nil {
 			return n, err
 		}
-		w.Flush()
 	}
 	return n, nil
 }
 
+func (i *wireSeq[T]) writeEvent(w writeFlusher, n int64, v T, seqErr error, buf *bytes.Buffer, enc *json.Encoder) (int64, error) {
+	n, err := i.writeKind(w, n, seqErr != nil)
+	if err != nil {
+		return n, err
+	}
+	n, err = i.writeMessage(w, n, v, seqErr, buf, enc)
+	if err != nil {
+		return n, err
+	}
+	w.Flush()
+	return n, nil
+}
+
 func (i *wireSeq[T]) writeKind(w writeFlusher, n int64, isErr bool) (int64, error) {
 	c, err := io.WriteString(w, "event: ")
 	if err != nil {
@@ -228,7 +916,11 @@ func parseSSE(r io.Reader) iter.Seq2[[]byte, error] {
 	s.Buffer(nil, maxTokenSize)
 	return func(yield func([]byte, error) bool) {
 		for s.Scan() {
-			msg, err := parse(s.Bytes())
+			data := skipComments(s.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			msg, err := parse(data)
 			if !yield(msg, err) {
 				return
 			}
@@ -239,17 +931,25 @@ func parseSSE(r io.Reader) iter.Seq2[[]byte, error] {
 	}
 }
 
+// skipComments removes the leading comment lines, which start with ':', from an SSE message.
+func skipComments(data []byte) []byte {
+	for bytes.HasPrefix(data, []byte(":")) {
+		_, data, _ = bytes.Cut(data, []byte("\n"))
+	}
+	return data
+}
+
 // NewCodecSeq constructs an iter.Seq codec that supports Server-Sent-Events.
 //
-// The events are "val" and "err".
+// The events are "val" and "err". Servers can keep idle streams open with [WithKeepAlive].
 //
 // Yielding a value and an error at the same time is not supported.
 func NewCodecSeq[T any]() Codec[iter.Seq2[T, error]] {
 	return Codec[iter.Seq2[T, error]]{
 		ContentType: "text/event-stream",
 		KeepOpen:    true,
-		Co: func(_ context.Context, seq iter.Seq2[T, error]) (io.Reader, error) {
-			return &wireSeq[T]{seq: seq}, nil
+		Co: func(ctx context.Context, seq iter.Seq2[T, error]) (io.Reader, error) {
+			return &wireSeq[T]{ctx: ctx, seq: seq}, nil
 		},
 		Dec: func(_ context.Context, wf io.Reader) (iter.Seq2[T, error], error) {
 			return func(yield func(T, error) bool) {
@@ -1,13 +1,23 @@
 package srpc_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"iter"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/empijei/srpc"
 	"github.com/empijei/tst"
@@ -18,6 +28,9 @@ func TestParseSSE(t *testing.T) {
 	r := strings.NewReader(`event: val
 data: "foo"
 
+: ping
+
+: comment
 event: val
 data: "bar"
 
@@ -89,6 +102,41 @@ type SeqResp struct {
 	Data int
 }
 
+func TestKeepAlive(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointSeq[SeqResp, Req]("/ticks")
+	const interval = 10 * time.Millisecond
+	ep.Register(mux, func(ctx context.Context, _ Req) (iter.Seq2[SeqResp, error], error) {
+		return func(yield func(SeqResp, error) bool) {
+			if !yield(SeqResp{1}, nil) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * interval):
+			}
+			yield(SeqResp{2}, nil)
+		}, nil
+	}, srpc.WithKeepAlive(interval))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req := tst.Do(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/ticks?srpc=%7B%7D", nil))(t)
+	resp := tst.Do(srv.Client().Do(req))(t)
+	body := string(tst.Do(io.ReadAll(resp.Body))(t))
+	tst.No(resp.Body.Close(), t)
+	tst.Is(true, strings.Contains(body, "data: {\"Data\":1}\n\n: ping\n\n"), t)
+
+	var got []SeqResp
+	for v, err := range tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, Req{}))(t) {
+		tst.No(err, t)
+		got = append(got, v)
+	}
+	tst.Is([]SeqResp{{1}, {2}}, got, t)
+}
+
 func TestRoundtrip(t *testing.T) {
 	ctx := tst.Go(t)
 	cd := srpc.NewCodecSeq[SeqResp]()
@@ -111,3 +159,607 @@ func TestRoundtrip(t *testing.T) {
 	}
 	tst.Is(10, c, t)
 }
+
+func TestCodecRoundTrip(t *testing.T) {
+	ctx := tst.Go(t)
+	tests := []struct {
+		name  string
+		codec srpc.Codec[Req]
+	}{
+		{"JSON", srpc.NewCodecJSON[Req]()},
+		{"JSONStrict", srpc.NewCodecJSONStrict[Req]()},
+		{"XML", srpc.NewCodecXML[Req]()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tst.Do(srpc.RoundTrip(ctx, tt.codec, Req{"value"}))(t)
+			tst.Is(Req{"value"}, got, t)
+		})
+	}
+
+	t.Run("Seq", func(t *testing.T) {
+		seq := slices.All([]SeqResp{{1}, {2}, {3}})
+		got := tst.Do(srpc.RoundTrip(ctx, srpc.NewCodecSeq[SeqResp](), func(yield func(SeqResp, error) bool) {
+			for _, v := range seq {
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}))(t)
+		var vals []SeqResp
+		for v, err := range got {
+			tst.No(err, t)
+			vals = append(vals, v)
+		}
+		tst.Is([]SeqResp{{1}, {2}, {3}}, vals, t)
+	})
+}
+
+func TestReader(t *testing.T) {
+	ctx := tst.Go(t)
+	const content = "some file content"
+	ep := srpc.NewEndpointReader[Req](http.MethodPost, "/download", "application/octet-stream")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (io.ReadCloser, error) {
+		srpc.ResponseHeader(ctx).Set("Content-Length", strconv.Itoa(len(content)))
+		srpc.Attachment(ctx, req.B)
+		return io.NopCloser(strings.NewReader(content)), nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("Remote", func(t *testing.T) {
+		rc := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, Req{"file.txt"}))(t)
+		defer func() { tst.No(rc.Close(), t) }()
+		got := tst.Do(io.ReadAll(rc))(t)
+		tst.Is(content, string(got), t)
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		hReq := tst.Do(http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/download", strings.NewReader(`{"B":"file.txt"}`)))(t)
+		hResp := tst.Do(srv.Client().Do(hReq))(t)
+		defer func() { tst.No(hResp.Body.Close(), t) }()
+		tst.Is("application/octet-stream", hResp.Header.Get("Content-Type"), t)
+		tst.Is(int64(len(content)), hResp.ContentLength, t)
+		tst.Is(`attachment; filename=file.txt`, hResp.Header.Get("Content-Disposition"), t)
+	})
+}
+
+func TestReaderSniffing(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpoint(http.MethodPost, "/files", srpc.NewCodecReaderSniff(), srpc.NewCodecJSON[Req]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (io.ReadCloser, error) {
+		switch req.B {
+		case "pdf":
+			return io.NopCloser(strings.NewReader("%PDF-1.7 ...")), nil
+		case "png":
+			return io.NopCloser(strings.NewReader("\x89PNG\r\n\x1a\n....")), nil
+		default:
+			srpc.ResponseHeader(ctx).Set("Content-Type", "text/csv")
+			return io.NopCloser(strings.NewReader("a,b\n1,2\n")), nil
+		}
+	})
+
+	// The in-memory transport doesn't sniff content like net/http does, so the type comes from the codec.
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	for req, want := range map[string]string{"pdf": "application/pdf", "png": "image/png", "csv": "text/csv"} {
+		var info srpc.ResponseInfo
+		rc := tst.Do(ep.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{req}))(t)
+		body := tst.Do(io.ReadAll(rc))(t)
+		tst.No(rc.Close(), t)
+		tst.Is(want, info.Header.Get("Content-Type"), t)
+		tst.Is(true, len(body) > 0, t)
+	}
+
+	// Without sniffing only the Content-Type set by the procedure is sent.
+	plain := srpc.NewEndpointReader[Req](http.MethodPost, "/plain", "")
+	plain.Register(mux, func(ctx context.Context, req Req) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("%PDF-1.7 ...")), nil
+	})
+	var info srpc.ResponseInfo
+	rc := tst.Do(plain.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{}))(t)
+	tst.No(rc.Close(), t)
+	tst.Is("", info.Header.Get("Content-Type"), t)
+}
+
+func TestPayload(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointPayload[Req](http.MethodPost, "/export")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (srpc.Payload, error) {
+		switch req.B {
+		case "csv":
+			return srpc.Payload{ContentType: "text/csv", Body: io.NopCloser(strings.NewReader("a,b\n1,2\n"))}, nil
+		case "json":
+			return srpc.Payload{ContentType: "application/json", Body: io.NopCloser(strings.NewReader(`[{"a":1,"b":2}]`))}, nil
+		default:
+			return srpc.Payload{ContentType: "application/pdf", Body: io.NopCloser(strings.NewReader("%PDF-1.7"))}, nil
+		}
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	for format, want := range map[string]struct{ ct, body string }{
+		"csv":  {"text/csv", "a,b\n1,2\n"},
+		"json": {"application/json", `[{"a":1,"b":2}]`},
+		"pdf":  {"application/pdf", "%PDF-1.7"},
+	} {
+		t.Run(format, func(t *testing.T) {
+			got := tst.Do(ep.Remote(conn)(ctx, Req{format}))(t)
+			defer func() { tst.No(got.Body.Close(), t) }()
+			tst.Is(want.ct, got.ContentType, t)
+			tst.Is(want.body, string(tst.Do(io.ReadAll(got.Body))(t)), t)
+		})
+	}
+}
+
+func TestEncoded(t *testing.T) {
+	ctx := tst.Go(t)
+	codec := srpc.NewCodecJSON[Resp]()
+	cached := tst.Do(srpc.Encode(ctx, codec, Resp{"cached"}))(t)
+	tst.Is(`{"A":"cached"}`, string(cached.Bytes()), t)
+
+	ep := srpc.NewEndpoint(http.MethodGet, "/hot", srpc.NewCodecEncoded(codec), srpc.NewCodecJSON[Req]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (srpc.Encoded[Resp], error) {
+		if req.B == "fresh" {
+			var fresh srpc.Encoded[Resp]
+			return fresh, nil
+		}
+		return cached, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"cached"}, got.Value(), t)
+	tst.Is(nil, got.Bytes(), t)
+	got = tst.Do(ep.Remote(conn)(ctx, Req{"fresh"}))(t)
+	tst.Is(Resp{}, got.Value(), t)
+}
+
+func TestRawBody(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointRawBody[Resp](http.MethodPost, "/upload", "application/octet-stream", 16)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, body *srpc.RawBody) (Resp, error) {
+		if _, err := body.Peek(17); !errors.Is(err, bufio.ErrBufferFull) {
+			return Resp{}, fmt.Errorf("peeking past the buffer: %v", err)
+		}
+		magic, err := body.Peek(4)
+		if err != nil {
+			return Resp{}, err
+		}
+		kind := "data"
+		if string(magic) == "\x89PNG" {
+			kind = "png"
+		}
+		n, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return Resp{}, err
+		}
+		return Resp{fmt.Sprintf("%s %s %d", kind, body.ContentType(), n)}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	content := "\x89PNG" + strings.Repeat("x", 100)
+	got := tst.Do(ep.Remote(conn)(ctx, srpc.NewRawBody(strings.NewReader(content), "image/png")))(t)
+	tst.Is(Resp{"png image/png 104"}, got, t)
+
+	got = tst.Do(ep.Remote(conn)(ctx, srpc.NewRawBody(strings.NewReader(strings.Repeat("y", 20)), "")))(t)
+	tst.Is(Resp{"data application/octet-stream 20"}, got, t)
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(buf []byte) (int, error) { return len(buf), nil }
+
+func TestCopyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(tst.Go(t))
+	var calls int
+	w := writerFunc(func(buf []byte) (int, error) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return len(buf), nil
+	})
+	_, err := srpc.CopyContext(ctx, w, endlessReader{})
+	tst.Is(true, errors.Is(err, context.Canceled), t)
+	tst.Is(3, calls, t)
+}
+
+func TestCopyContextFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(tst.Go(t))
+	path := filepath.Join(t.TempDir(), "large")
+	tst.No(os.WriteFile(path, make([]byte, 1<<20), 0o600), t)
+	f := tst.Do(os.Open(path))(t)
+	defer func() { _ = f.Close() }()
+	var calls int
+	w := writerFunc(func(buf []byte) (int, error) {
+		calls++
+		cancel()
+		return len(buf), nil
+	})
+	n, err := srpc.CopyContext(ctx, w, f)
+	tst.Is(true, errors.Is(err, context.Canceled), t)
+	tst.Is(1, calls, t)
+	tst.Is(true, n < 1<<20, t)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(buf []byte) (int, error) { return f(buf) }
+
+func TestStreamUpload(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpoint(http.MethodPost, "/sum", srpc.NewCodecJSON[int](), srpc.NewCodecStream[SeqResp]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, seq iter.Seq2[SeqResp, error]) (int, error) {
+		sum := 0
+		for v, err := range seq {
+			if err != nil {
+				return 0, err
+			}
+			sum += v.Data
+		}
+		return sum, nil
+	})
+	var chunked atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunked.Store(r.ContentLength == -1 && slices.Contains(r.TransferEncoding, "chunked"))
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	seq := func(yield func(SeqResp, error) bool) {
+		for i := range 100 {
+			if !yield(SeqResp{i}, nil) {
+				return
+			}
+		}
+	}
+	got := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, seq))(t)
+	tst.Is(4950, got, t)
+	tst.Is(true, chunked.Load(), t)
+}
+
+type XMLResp struct {
+	XMLName struct{} `xml:"resp"`
+	A       string   `xml:"a"`
+}
+
+type XMLReq struct {
+	XMLName struct{} `xml:"req"`
+	B       string   `xml:"b,attr"`
+}
+
+func TestCoTo(t *testing.T) {
+	ctx := tst.Go(t)
+	c := srpc.NewCodecReader("text/plain")
+	c.KeepOpen = false
+	c.CoTo = func(_ context.Context, w io.Writer, rc io.ReadCloser) error {
+		defer func() { _ = rc.Close() }()
+		buf := tst.Do(io.ReadAll(rc))(t)
+		if string(buf) == "fail" {
+			return errors.New("cannot encode")
+		}
+		_, err := fmt.Fprintf(w, "streamed %s", buf)
+		return err
+	}
+	ep := srpc.NewEndpoint(http.MethodPost, "/coto", c, srpc.NewCodecJSON[Req]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(req.B)), nil
+	}, srpc.WithResponseCompression(srpc.GzipEncoding))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil, srpc.WithAcceptEncoding(srpc.GzipEncoding)))(t)
+
+	rc := tst.Do(ep.Remote(conn)(ctx, Req{"data"}))(t)
+	tst.Is("streamed data", string(tst.Do(io.ReadAll(rc))(t)), t)
+
+	// Failures before anything is written are reported as encoding errors.
+	_, err := ep.Remote(conn)(ctx, Req{"fail"})
+	tst.Is(true, errors.Is(err, srpc.ErrInternal), t)
+	tst.Err("Failed to encode response.", err, t)
+}
+
+func TestXML(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointXML[XMLResp, XMLReq](http.MethodPost, "/xml")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req XMLReq) (XMLResp, error) {
+		return XMLResp{A: "xml" + req.B}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("Remote", func(t *testing.T) {
+		got := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, XMLReq{B: "req"}))(t)
+		tst.Is("xmlreq", got.A, t)
+	})
+
+	t.Run("Wire", func(t *testing.T) {
+		hReq := tst.Do(http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/xml", strings.NewReader(`<req b="raw"/>`)))(t)
+		hResp := tst.Do(srv.Client().Do(hReq))(t)
+		defer func() { tst.No(hResp.Body.Close(), t) }()
+		tst.Is("application/xml", hResp.Header.Get("Content-Type"), t)
+		body := tst.Do(io.ReadAll(hResp.Body))(t)
+		tst.Is(`<resp><a>xmlraw</a></resp>`, string(body), t)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		hReq := tst.Do(http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/xml", strings.NewReader(`<req`)))(t)
+		hResp := tst.Do(srv.Client().Do(hReq))(t)
+		defer func() { tst.No(hResp.Body.Close(), t) }()
+		tst.Is(http.StatusBadRequest, hResp.StatusCode, t)
+	})
+}
+
+func TestStreamErrorTrailers(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpoint(http.MethodPost, "/count", srpc.NewCodecStream[SeqResp](), srpc.NewCodecJSON[int]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, n int) (iter.Seq2[SeqResp, error], error) {
+		return func(yield func(SeqResp, error) bool) {
+			for i := range n {
+				if !yield(SeqResp{i}, nil) {
+					return
+				}
+			}
+			yield(SeqResp{}, srpc.NewWireError(http.StatusConflict, "ran out"))
+		}, nil
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	for name, conn := range map[string]*srpc.Transport{
+		"HTTP":     tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t),
+		"InMemory": tst.Do(srpc.NewInMemoryTransport(mux))(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			seq := tst.Do(ep.Remote(conn)(ctx, 2))(t)
+			var (
+				got  []int
+				last error
+			)
+			for v, err := range seq {
+				if err != nil {
+					last = err
+					break
+				}
+				got = append(got, v.Data)
+			}
+			tst.Is([]int{0, 1}, got, t)
+			werr := tst.DoB(errors.AsType[*srpc.WireError](last))(t)
+			tst.Is(http.StatusConflict, werr.Code, t)
+			tst.Is("ran out", werr.Msg, t)
+		})
+	}
+}
+
+func TestJSONStrict(t *testing.T) {
+	ctx := tst.Go(t)
+	lenient := srpc.NewCodecJSON[Req]()
+	strict := srpc.NewCodecJSONStrict[Req]()
+
+	got := tst.Do(lenient.Dec(ctx, strings.NewReader(`{"B":"x","C":"typo"}`)))(t)
+	tst.Is(Req{"x"}, got, t)
+	got = tst.Do(strict.Dec(ctx, strings.NewReader(`{"B":"x"}`)))(t)
+	tst.Is(Req{"x"}, got, t)
+	_, err := strict.Dec(ctx, strings.NewReader(`{"B":"x","C":"typo"}`))
+	tst.Err(`unknown field "C"`, err, t)
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	ctx := tst.Go(t)
+	type Doc struct {
+		Zeta  string         `json:"zeta"`
+		Alpha map[string]int `json:"alpha"`
+		Big   float64        `json:"big"`
+	}
+	c := srpc.NewCodecCanonicalJSON[Doc]()
+	doc := Doc{Zeta: "<a & b>", Alpha: map[string]int{"y": 2, "x": 1}, Big: 12345678901234567890}
+	r := tst.Do(c.Co(ctx, doc))(t)
+	got := string(tst.Do(io.ReadAll(r))(t))
+	tst.Is(`{"alpha":{"x":1,"y":2},"big":12345678901234567000,"zeta":"<a & b>"}`, got, t)
+	tst.Is(doc, tst.Do(c.Dec(ctx, strings.NewReader(got)))(t), t)
+}
+
+func TestJSONPooled(t *testing.T) {
+	ctx := tst.Go(t)
+	c := srpc.NewCodecJSONPooled[Resp]()
+	r := tst.Do(c.Co(ctx, Resp{"<pooled>"}))(t)
+	want := tst.Do(io.ReadAll(tst.Do(srpc.NewCodecJSON[Resp]().Co(ctx, Resp{"<pooled>"}))(t)))(t)
+	tst.Is(string(want), string(tst.Do(io.ReadAll(r))(t)), t)
+	rc, ok := r.(io.Closer)
+	tst.Is(true, ok, t)
+	tst.No(rc.Close(), t)
+	tst.No(rc.Close(), t)
+
+	ep := srpc.NewEndpoint(http.MethodPost, "/pooled", c, c)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Resp) (Resp, error) { return Resp{req.A + "!"}, nil })
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	for _, a := range []string{"a", strings.Repeat("b", 100*1024), "c"} {
+		got := tst.Do(ep.Remote(conn)(ctx, Resp{a}))(t)
+		tst.Is(Resp{a + "!"}, got, t)
+	}
+}
+
+func BenchmarkJSONCo(b *testing.B) {
+	ctx := context.Background()
+	v := SeqResp{Data: 42}
+	for name, c := range map[string]srpc.Codec[SeqResp]{
+		"Plain":  srpc.NewCodecJSON[SeqResp](),
+		"Pooled": srpc.NewCodecJSONPooled[SeqResp](),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				r, err := c.Co(ctx, v)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				if c, ok := r.(io.Closer); ok {
+					_ = c.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpoint(http.MethodGet, "/export", srpc.NewCodecJSONArray[SeqResp](), srpc.NewCodecJSON[int]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, n int) (iter.Seq2[SeqResp, error], error) {
+		return func(yield func(SeqResp, error) bool) {
+			for i := range n {
+				if !yield(SeqResp{i}, nil) {
+					return
+				}
+			}
+			if n > 3 {
+				yield(SeqResp{}, srpc.NewWireError(http.StatusConflict, "too many"))
+			}
+		}, nil
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	collect := func(seq iter.Seq2[SeqResp, error]) ([]int, error) {
+		var got []int
+		for v, err := range seq {
+			if err != nil {
+				return got, err
+			}
+			got = append(got, v.Data)
+		}
+		return got, nil
+	}
+
+	t.Run("Wire", func(t *testing.T) {
+		req := tst.Do(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/export?srpc=3", nil))(t)
+		resp := tst.Do(srv.Client().Do(req))(t)
+		defer resp.Body.Close()
+		body := tst.Do(io.ReadAll(resp.Body))(t)
+		tst.Is(`[{"Data":0},{"Data":1},{"Data":2}]`, string(body), t)
+	})
+	t.Run("Roundtrip", func(t *testing.T) {
+		seq := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, 3))(t)
+		got := tst.Do(collect(seq))(t)
+		tst.Is([]int{0, 1, 2}, got, t)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		seq := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, 0))(t)
+		got := tst.Do(collect(seq))(t)
+		tst.Is([]int(nil), got, t)
+	})
+	t.Run("Error", func(t *testing.T) {
+		seq := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, 5))(t)
+		got, err := collect(seq)
+		tst.Is([]int{0, 1, 2, 3, 4}, got, t)
+		tst.Is(true, errors.Is(err, srpc.ErrConflict), t)
+	})
+	t.Run("Blocked", func(t *testing.T) {
+		// The sequence blocks until the client gets the elements that were yielded before.
+		release := make(chan struct{})
+		blocked := srpc.NewEndpoint(http.MethodGet, "/blocked", srpc.NewCodecJSONArray[SeqResp](), srpc.NewCodecJSON[int]())
+		blocked.Register(mux, func(ctx context.Context, _ int) (iter.Seq2[SeqResp, error], error) {
+			return func(yield func(SeqResp, error) bool) {
+				if !yield(SeqResp{0}, nil) || !yield(SeqResp{1}, nil) {
+					return
+				}
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return
+				}
+				yield(SeqResp{2}, nil)
+			}, nil
+		})
+		seq := tst.Do(blocked.RemoteWithOrigin(srv.URL)(ctx, 0))(t)
+		var got []int
+		for v, err := range seq {
+			tst.No(err, t)
+			got = append(got, v.Data)
+			if v.Data == 1 {
+				close(release)
+			}
+		}
+		tst.Is([]int{0, 1, 2}, got, t)
+	})
+	t.Run("Upload", func(t *testing.T) {
+		cd := srpc.NewCodecJSONArray[SeqResp]()
+		r := tst.Do(cd.Co(ctx, func(yield func(SeqResp, error) bool) { yield(SeqResp{7}, nil) }))(t)
+		buf := tst.Do(io.ReadAll(r))(t)
+		tst.Is(`[{"Data":7}]`, string(buf), t)
+	})
+}
+
+func TestCodecFallback(t *testing.T) {
+	ctx := tst.Go(t)
+	type User struct{ Name string }
+	type legacyUser struct{ User string }
+	legacy := srpc.NewCodecJSONStrict[User]()
+	legacy.Dec = func(ctx context.Context, r io.Reader) (User, error) {
+		old, err := srpc.NewCodecJSONStrict[legacyUser]().Dec(ctx, r)
+		return User{old.User}, err
+	}
+	reqc := srpc.NewCodecFallback(srpc.NewCodecJSONStrict[User](), legacy)
+	ep := srpc.NewEndpoint(http.MethodPost, "/users", srpc.NewCodecJSON[Resp](), reqc)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, u User) (Resp, error) { return Resp{u.Name}, nil })
+
+	tcs := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "Current", body: `{"Name":"alice"}`, want: http.StatusOK},
+		{name: "Legacy", body: `{"User":"alice"}`, want: http.StatusOK},
+		{name: "Invalid", body: `{"Email":"alice"}`, want: http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, "/users", strings.NewReader(tc.body)))
+			tst.Is(tc.want, rec.Code, t)
+			if tc.want == http.StatusOK {
+				tst.Is(`{"A":"alice"}`, strings.TrimSpace(rec.Body.String()), t)
+			}
+		})
+	}
+
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	got := tst.Do(ep.Remote(conn)(ctx, User{"bob"}))(t)
+	tst.Is(Resp{"bob"}, got, t)
+
+	// Values partially decoded by primary are not returned.
+	u, err := reqc.Dec(ctx, strings.NewReader(`{"Name":"alice","Email":"alice"}`))
+	tst.Is(true, err != nil, t)
+	tst.Is(User{}, u, t)
+}
+
+func TestSameMediaType(t *testing.T) {
+	tst.Go(t)
+	tcs := []struct {
+		a, b string
+		want bool
+	}{
+		{"application/json", "application/json", true},
+		{"application/json; charset=utf-8", "application/json", true},
+		{"Application/JSON", "application/json", true},
+		{"text/html", "application/json", false},
+		{"", "application/json", true},
+		{"application/json", "", true},
+		{"not a media type", "application/json", false},
+	}
+	for _, tc := range tcs {
+		tst.Is(tc.want, srpc.SameMediaType(tc.a, tc.b), t)
+	}
+}
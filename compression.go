@@ -0,0 +1,237 @@
+package srpc
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Encoding is a content coding that can be used to compress response bodies.
+//
+// srpc provides [GzipEncoding] and [DeflateEncoding]. It doesn't provide Brotli, as the standard library
+// has no implementation of it and srpc has no dependencies. Other codings can be plugged in by
+// wrapping third-party implementations, for example Brotli:
+//
+//	var brotliEncoding = srpc.Encoding{
+//		Name:      "br",
+//		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil },
+//		NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(brotli.NewReader(r)), nil },
+//	}
+type Encoding struct {
+	// Name is the token used in the Accept-Encoding and Content-Encoding headers.
+	Name string
+	// NewWriter returns a writer that compresses to w. If the returned writer has a Flush() error
+	// method it is called when streaming responses are flushed.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader that decompresses r.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// GzipEncoding compresses bodies with gzip.
+	GzipEncoding = Encoding{
+		Name:      "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	// DeflateEncoding compresses bodies with zlib-wrapped deflate.
+	DeflateEncoding = Encoding{
+		Name:      "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil },
+		NewReader: zlib.NewReader,
+	}
+)
+
+// negotiateEncoding returns the encoding among encs that the client prefers according to
+// the acceptEncoding header. Ties are broken by the order of encs.
+func negotiateEncoding(acceptEncoding string, encs []Encoding) (Encoding, bool) {
+	var (
+		best  Encoding
+		bestQ float64
+	)
+	accepted := parseWeighted(acceptEncoding)
+	for _, enc := range encs {
+		q, wildcard := -1.0, -1.0
+		for _, a := range accepted {
+			switch {
+			case strings.EqualFold(a.value, enc.Name) && q < 0:
+				q = a.q
+			case a.value == "*" && wildcard < 0:
+				wildcard = a.q
+			}
+		}
+		if q < 0 {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// WithResponseCompression makes endpoints compress responses with the encoding, among encs,
+// that clients prefer according to their Accept-Encoding header. When clients have no preference
+// the order of encs is used.
+//
+// Compressed requests are only accepted with [WithRequestDecompression].
+func WithResponseCompression(encs ...Encoding) ServerOption {
+	return func(c *serverConfig) { c.encodings = encs }
+}
+
+// WithCompressionMinSize makes endpoints that use [WithResponseCompression] send responses smaller than
+// n bytes uncompressed, as compressing them costs more than it saves.
+//
+// The size is known for responses buffered by their codec, like JSON ones, and for responses with a
+// Content-Length header set by the procedure. Other streamed responses are always compressed.
+func WithCompressionMinSize(n int64) ServerOption {
+	return func(c *serverConfig) { c.compressMinSize = n }
+}
+
+// responseSize returns the size of the response body r, with header h, and false if it is not known.
+func responseSize(r io.Reader, h http.Header) (int64, bool) {
+	if l, ok := r.(interface{ Len() int }); ok {
+		return int64(l.Len()), true
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		return n, true
+	}
+	return 0, false
+}
+
+// compressWriter is a [http.ResponseWriter] that compresses the body.
+type compressWriter struct {
+	http.ResponseWriter
+	w io.WriteCloser
+}
+
+// newCompressWriter sets the response headers for enc and returns a writer that compresses to w.
+func newCompressWriter(w http.ResponseWriter, enc Encoding) (*compressWriter, error) {
+	cw, err := enc.NewWriter(w)
+	if err != nil {
+		return nil, fmt.Errorf("compressing with %s: %w", enc.Name, err)
+	}
+	w.Header().Set("Content-Encoding", enc.Name)
+	w.Header().Del("Content-Length")
+	return &compressWriter{ResponseWriter: w, w: cw}, nil
+}
+
+func (w *compressWriter) Write(buf []byte) (int, error) { return w.w.Write(buf) }
+
+// Flush implements [http.Flusher].
+func (w *compressWriter) Flush() {
+	if f, ok := w.w.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close writes any buffered data and the footer of the compressed stream.
+func (w *compressWriter) Close() error { return w.w.Close() }
+
+// Unwrap allows [http.ResponseController] to access the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// WithAcceptEncoding makes the transport ask for responses compressed with encs, in order of preference,
+// and decompress them.
+//
+// Without this option the [http.Client] transparently negotiates gzip, unless it was disabled.
+func WithAcceptEncoding(encs ...Encoding) TransportOption {
+	return func(t *Transport) {
+		var names []string
+		for _, enc := range encs {
+			names = append(names, enc.Name)
+		}
+		t.header = t.header.Clone()
+		if t.header == nil {
+			t.header = http.Header{}
+		}
+		t.header.Set("Accept-Encoding", strings.Join(names, ", "))
+		t.encodings = encs
+	}
+}
+
+// decompressBody replaces the body of resp with its decompressed content if it was compressed
+// with one of encs.
+func decompressBody(resp *http.Response, encs []Encoding) error {
+	ce := resp.Header.Get("Content-Encoding")
+	if ce == "" {
+		return nil
+	}
+	for _, enc := range encs {
+		if !strings.EqualFold(ce, enc.Name) {
+			continue
+		}
+		r, err := enc.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("decompressing %s response: %w", enc.Name, err)
+		}
+		resp.Body = &decompressReader{ReadCloser: r, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		return nil
+	}
+	return nil
+}
+
+// decompressReader closes both the decompressor and the underlying body.
+type decompressReader struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (r *decompressReader) Close() error {
+	err := r.ReadCloser.Close()
+	if berr := r.body.Close(); err == nil {
+		err = berr
+	}
+	return err
+}
+
+// WithRequestDecompression makes endpoints decompress request bodies sent with a Content-Encoding
+// before decoding them. Bodies compressed with gzip or deflate are accepted, encs adds other codings,
+// like Brotli, for which srpc has no implementation. Requests with other codings are rejected with
+// 415 Unsupported Media Type.
+//
+// Requests that decompress to more than maxBytes, if positive, are rejected with 413 Request Entity
+// Too Large, which protects endpoints from small bodies that decompress to huge ones.
+//
+// Endpoints whose request codec keeps the body open, like [NewCodecReader], are given the body as sent,
+// so that uploads of compressed files are not changed.
+//
+// Without this option the Content-Encoding of requests is ignored.
+func WithRequestDecompression(maxBytes int64, encs ...Encoding) ServerOption {
+	return func(c *serverConfig) {
+		c.requestEncodings = append(slices.Clip(encs), GzipEncoding, DeflateEncoding)
+		c.maxDecompressedBytes = maxBytes
+	}
+}
+
+// decompressRequest returns a reader that decompresses body according to the contentEncoding header
+// of the request, using one of encs.
+//
+// It returns false if the coding is not supported.
+func decompressRequest(body io.ReadCloser, contentEncoding string, encs []Encoding) (io.ReadCloser, bool, error) {
+	ce := strings.TrimSpace(contentEncoding)
+	if ce == "" || strings.EqualFold(ce, "identity") {
+		return body, true, nil
+	}
+	for _, enc := range encs {
+		if !strings.EqualFold(ce, enc.Name) {
+			continue
+		}
+		r, err := enc.NewReader(body)
+		if err != nil {
+			return nil, true, fmt.Errorf("decompressing %s request: %w", enc.Name, err)
+		}
+		return &decompressReader{ReadCloser: r, body: body}, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,229 @@
+package srpc_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestCompression(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	long := strings.Repeat("compressible ", 100)
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{long + req.B}, nil
+	}, srpc.WithResponseCompression(srpc.DeflateEncoding, srpc.GzipEncoding))
+
+	var encoding string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		encoding = w.Header().Get("Content-Encoding")
+	})
+
+	tcs := []struct {
+		name string
+		encs []srpc.Encoding
+		want string
+	}{
+		{name: "ServerPreference", encs: []srpc.Encoding{srpc.GzipEncoding, srpc.DeflateEncoding}, want: "deflate"},
+		{name: "Gzip", encs: []srpc.Encoding{srpc.GzipEncoding}, want: "gzip"},
+		{name: "None", want: ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []srpc.TransportOption
+			if tc.encs != nil {
+				opts = append(opts, srpc.WithAcceptEncoding(tc.encs...))
+			}
+			conn := tst.Do(srpc.NewInMemoryTransport(h, opts...))(t)
+			got := tst.Do(Ep.Remote(conn)(ctx, Req{"!"}))(t)
+			tst.Is(Resp{long + "!"}, got, t)
+			tst.Is(tc.want, encoding, t)
+		})
+	}
+
+	t.Run("HTTPClient", func(t *testing.T) {
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		got := tst.Do(Ep.RemoteWithOrigin(srv.URL)(ctx, Req{"!"}))(t)
+		tst.Is(Resp{long + "!"}, got, t)
+		tst.Is("gzip", encoding, t)
+	})
+}
+
+func TestPluggedEncoding(t *testing.T) {
+	ctx := tst.Go(t)
+	// br stands in for a third-party Brotli implementation.
+	br := srpc.Encoding{Name: "br", NewWriter: srpc.DeflateEncoding.NewWriter, NewReader: srpc.DeflateEncoding.NewReader}
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	}, srpc.WithResponseCompression(br, srpc.GzipEncoding), srpc.WithRequestDecompression(1<<10, br))
+
+	var encoding string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		encoding = w.Header().Get("Content-Encoding")
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(h, srpc.WithAcceptEncoding(br, srpc.GzipEncoding)))(t)
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{"!"}))(t)
+	tst.Is(Resp{"!"}, got, t)
+	tst.Is("br", encoding, t)
+
+	var body bytes.Buffer
+	w := tst.Do(br.NewWriter(&body))(t)
+	_ = tst.Do(io.WriteString(w, `{"B":"hi"}`))(t)
+	tst.No(w.Close(), t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/foo", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "br")
+	mux.ServeHTTP(rec, req)
+	tst.Is(http.StatusOK, rec.Code, t)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tst.Go(t)
+	encs := []srpc.Encoding{srpc.GzipEncoding, srpc.DeflateEncoding}
+	tcs := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"br", ""},
+		{"deflate, gzip;q=0.5", "deflate"},
+		{"gzip, deflate", "gzip"},
+		{"*", "gzip"},
+		{"gzip;q=0, *", "deflate"},
+		{"identity", ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.header, func(t *testing.T) {
+			enc, _ := srpc.NegotiateEncoding(tc.header, encs)
+			tst.Is(tc.want, enc.Name, t)
+		})
+	}
+}
+
+func TestRequestDecompression(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithRequestDecompression(64))
+	Ep.Register(srv, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	})
+	upload := srpc.NewEndpoint(http.MethodPost, "/upload", srpc.NewCodecReader("application/gzip"), srpc.NewCodecReader("application/gzip"))
+	upload.Register(srv, func(ctx context.Context, req io.ReadCloser) (io.ReadCloser, error) {
+		return req, nil
+	})
+	plain := http.NewServeMux()
+	Ep.Register(plain, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	})
+	compress := func(enc srpc.Encoding, body string) string {
+		var buf bytes.Buffer
+		w := tst.Do(enc.NewWriter(&buf))(t)
+		_ = tst.Do(io.WriteString(w, body))(t)
+		tst.No(w.Close(), t)
+		return buf.String()
+	}
+	long := `{"B":"` + strings.Repeat("a", 100) + `"}`
+
+	tcs := []struct {
+		name     string
+		mux      *http.ServeMux
+		path     string
+		encoding string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{name: "Identity", body: `{"B":"hi"}`, want: http.StatusOK, wantBody: `{"A":"hi"}`},
+		{name: "Gzip", encoding: "gzip", body: compress(srpc.GzipEncoding, `{"B":"hi"}`), want: http.StatusOK, wantBody: `{"A":"hi"}`},
+		{name: "Deflate", encoding: "deflate", body: compress(srpc.DeflateEncoding, `{"B":"hi"}`), want: http.StatusOK, wantBody: `{"A":"hi"}`},
+		{name: "Corrupted", encoding: "gzip", body: `{"B":"hi"}`, want: http.StatusBadRequest},
+		{name: "Unknown", encoding: "br", body: `{"B":"hi"}`, want: http.StatusUnsupportedMediaType},
+		{name: "TooLarge", encoding: "gzip", body: compress(srpc.GzipEncoding, long), want: http.StatusRequestEntityTooLarge},
+		{name: "Disabled", mux: plain, encoding: "gzip", body: compress(srpc.GzipEncoding, `{"B":"hi"}`), want: http.StatusBadRequest},
+		{
+			name: "Reader", path: "/upload", encoding: "gzip", body: compress(srpc.GzipEncoding, long),
+			want: http.StatusOK, wantBody: compress(srpc.GzipEncoding, long),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			m, path := mux, "/foo"
+			if tc.mux != nil {
+				m = tc.mux
+			}
+			if tc.path != "" {
+				path = tc.path
+			}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(tst.Go(t), http.MethodPost, path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", tc.encoding)
+			m.ServeHTTP(rec, req)
+			tst.Is(tc.want, rec.Code, t)
+			if tc.want == http.StatusOK {
+				tst.Is(strings.TrimSpace(tc.wantBody), strings.TrimSpace(rec.Body.String()), t)
+			}
+		})
+	}
+}
+
+func TestCompressionVary(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	}, srpc.WithResponseCompression(srpc.GzipEncoding))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/foo",
+		strings.NewReader(`{"B":"`+strings.Repeat("compressible ", 100)+`"}`))
+	req.Header.Set("Accept-Encoding", "br")
+	mux.ServeHTTP(rec, req)
+	tst.Is(http.StatusOK, rec.Code, t)
+	tst.Is("", rec.Header().Get("Content-Encoding"), t)
+	tst.Is("Accept-Encoding", rec.Header().Get("Vary"), t)
+}
+
+func TestCompressionMinSize(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	}, srpc.WithResponseCompression(srpc.GzipEncoding), srpc.WithCompressionMinSize(100))
+
+	var encoding, vary string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		encoding = w.Header().Get("Content-Encoding")
+		vary = w.Header().Get("Vary")
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(h, srpc.WithAcceptEncoding(srpc.GzipEncoding)))(t)
+
+	tcs := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{name: "Small", req: "tiny", want: ""},
+		{name: "Large", req: strings.Repeat("compressible ", 10), want: "gzip"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tst.Do(Ep.Remote(conn)(ctx, Req{tc.req}))(t)
+			tst.Is(Resp{tc.req}, got, t)
+			tst.Is(tc.want, encoding, t)
+			tst.Is("Accept-Encoding", vary, t)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package srpc
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Values are stored in contexts with keys of unexported types, so that they don't collide with
+// the ones of other packages, and are read with the getters of this package.
+type (
+	requestKey        struct{}
+	responseHeaderKey struct{}
+	contentTypeKey    struct{}
+	cleanupsKey       struct{}
+	callOptionsKey    struct{}
+	headersKey        struct{}
+	patternKey        struct{}
+	statusKey         struct{}
+	earlyHintsKey     struct{}
+	requestIDKey      struct{}
+	identityKey       struct{}
+	clientIPKey       struct{}
+	keepAliveKey      struct{}
+	propagatedKey     struct{}
+	verifiedKey       struct{}
+)
+
+// requestFromContext returns the request being served, or nil outside of served procedures.
+func requestFromContext(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return r
+}
+
+// requestHeader returns the header of the request being served, or an empty header outside of served procedures.
+func requestHeader(ctx context.Context) http.Header {
+	if r := requestFromContext(ctx); r != nil {
+		return r.Header
+	}
+	return http.Header{}
+}
+
+// IfMatchFromContext returns the If-Match header of the request being served.
+//
+// Procedures implementing optimistic concurrency can compare it with the current ETag of the
+// resource and return [PreconditionFailed] if they don't match.
+func IfMatchFromContext(ctx context.Context) string {
+	return requestHeader(ctx).Get("If-Match")
+}
+
+// PatternFromContext returns the pattern of the endpoint serving the request, for example "GET /users/{id}".
+//
+// Unlike the request path it has a low cardinality, which makes it suitable to group logs and metrics.
+// Outside of served procedures it returns an empty string.
+func PatternFromContext(ctx context.Context) string {
+	p, _ := ctx.Value(patternKey{}).(string)
+	return p
+}
+
+// ContextWithIdentity returns a context that carries the identity of the caller, readable with [IdentityFromContext].
+//
+// It is meant to be used by [Authenticator]s, so that procedures and codecs can read the identity
+// without knowing how callers are authenticated.
+func ContextWithIdentity(ctx context.Context, id any) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity of the caller set with [ContextWithIdentity],
+// and false if there is none or it is not a T.
+func IdentityFromContext[T any](ctx context.Context) (T, bool) {
+	id, ok := ctx.Value(identityKey{}).(T)
+	return id, ok
+}
+
+// HeaderFromContext returns the value of the named request header, if it was made available
+// with [WithHeadersInContext] or [ContextWithHeader].
+func HeaderFromContext(ctx context.Context, name string) string {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h.Get(name)
+}
+
+// ContextWithHeader returns a context that carries a header readable with [HeaderFromContext].
+//
+// It can be used to test procedures that read headers from their context.
+func ContextWithHeader(ctx context.Context, name, value string) context.Context {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	h = h.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set(name, value)
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+// withRequestHeaders returns a context that carries the named headers of r.
+func withRequestHeaders(ctx context.Context, r *http.Request, names []string) context.Context {
+	if len(names) == 0 {
+		return ctx
+	}
+	h := http.Header{}
+	for _, n := range names {
+		if v, ok := r.Header[n]; ok {
+			h[n] = v
+		}
+	}
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+// AcceptLanguageFromContext returns the languages listed in the Accept-Language header
+// of the request being served, ordered by decreasing preference.
+//
+// Procedures can use it to pick a locale, srpc does not perform any translation.
+func AcceptLanguageFromContext(ctx context.Context) []string {
+	var langs []string
+	for _, w := range parseWeighted(requestHeader(ctx).Get("Accept-Language")) {
+		if w.q > 0 {
+			langs = append(langs, w.value)
+		}
+	}
+	return langs
+}
+
+// PathValue returns the value of the named path wildcard of the request being served.
+//
+// See [http.Request.PathValue] for details.
+func PathValue(ctx context.Context, name string) string {
+	if r := requestFromContext(ctx); r != nil {
+		return r.PathValue(name)
+	}
+	return ""
+}
+
+// callOptions are the per-call settings carried by the context passed to remote procedures.
+type callOptions struct {
+	header     http.Header
+	cookies    []*http.Cookie
+	pathValues map[string]string
+	info       *ResponseInfo
+	hook       func(*http.Response)
+}
+
+func callOptionsFromContext(ctx context.Context) callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return o
+}
+
+// WithCallHeader returns a context that makes remote procedures send the given header,
+// overriding the defaults set with [WithHeaders].
+//
+// The Content-Type header is always set by the request codec, and the headers set by transport options
+// like [WithBasicAuth] are applied last. Cookies are merged by name, see [WithCallCookie].
+func WithCallHeader(ctx context.Context, key, value string) context.Context {
+	o := callOptionsFromContext(ctx)
+	o.header = o.header.Clone()
+	if o.header == nil {
+		o.header = http.Header{}
+	}
+	o.header.Set(key, value)
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// WithPathValue returns a context that makes remote procedures replace the named
+// wildcard of the endpoint path with value.
+//
+// Calls to endpoints with wildcards in their path fail if a value is not provided for each of them.
+func WithPathValue(ctx context.Context, name, value string) context.Context {
+	o := callOptionsFromContext(ctx)
+	o.pathValues = maps.Clone(o.pathValues)
+	if o.pathValues == nil {
+		o.pathValues = map[string]string{}
+	}
+	o.pathValues[name] = value
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// WithIfMatch returns a context that makes remote procedures send an If-Match header with the given ETag,
+// which must include the quotes.
+//
+// Servers can read it with [IfMatchFromContext].
+func WithIfMatch(ctx context.Context, etag string) context.Context {
+	return WithCallHeader(ctx, "If-Match", etag)
+}
+
+// WithAcceptLanguage returns a context that makes remote procedures send an Accept-Language header
+// listing langs in order of preference, overriding the default set by [WithDefaultAcceptLanguage].
+//
+// Servers can read it with [AcceptLanguageFromContext].
+func WithAcceptLanguage(ctx context.Context, langs ...string) context.Context {
+	return WithCallHeader(ctx, "Accept-Language", formatAcceptLanguage(langs))
+}
+
+// ResponseHeader returns the header map that will be sent with the response.
+//
+// It can be used by procedures served by [Endpoint.Register] to set additional headers.
+// The Content-Type header is always set by the response codec.
+// Outside of a served procedure it returns an empty, detached header.
+func ResponseHeader(ctx context.Context) http.Header {
+	if h, ok := ctx.Value(responseHeaderKey{}).(http.Header); ok {
+		return h
+	}
+	return http.Header{}
+}
+
+// SetStatus sets the status of a successful response, for example 201 Created or 202 Accepted,
+// instead of 200 OK or, for empty responses, 204 No Content.
+//
+// It can be used by procedures served by [Endpoint.Register], statuses outside of the 2xx range are ignored:
+// failures are reported by returning errors. Clients can read the status with [WithResponseInfo].
+func SetStatus(ctx context.Context, code int) {
+	if p, ok := ctx.Value(statusKey{}).(*int); ok && code >= http.StatusOK && code < http.StatusMultipleChoices {
+		*p = code
+	}
+}
+
+// statusFromContext returns the status set with [SetStatus], or 0.
+func statusFromContext(ctx context.Context) int {
+	if p, ok := ctx.Value(statusKey{}).(*int); ok {
+		return *p
+	}
+	return 0
+}
+
+// Attachment sets the Content-Disposition response header so that clients
+// treat the response as a file download with the given name.
+func Attachment(ctx context.Context, filename string) {
+	ResponseHeader(ctx).Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+// Created sets the status of the response to 201 Created and its Location header to the URL
+// of the created resource, and returns body, so that procedures can end with:
+//
+//	return srpc.Created(ctx, "/items/"+item.ID, item), nil
+//
+// Clients can read the location with [WithResponseInfo].
+func Created[T any](ctx context.Context, location string, body T) T {
+	ResponseHeader(ctx).Set("Location", location)
+	SetStatus(ctx, http.StatusCreated)
+	return body
+}
+
+// Preload adds a Link header to the response that asks browsers to preload the resource at url,
+// where as is the kind of resource, for example "script", "style" or "image".
+//
+// Characters of url that could end the link, like '>' and ',', are percent-encoded,
+// and hints whose as is not a valid token are ignored.
+//
+// Hints can be sent before the response with [SendEarlyHints].
+func Preload(ctx context.Context, url, as string) {
+	if !isToken(as) {
+		return
+	}
+	ResponseHeader(ctx).Add("Link", fmt.Sprintf("<%s>; rel=preload; as=%s", escapeLinkTarget(url), as))
+}
+
+// escapeLinkTarget percent-encodes the bytes of url that are not allowed between the angle brackets
+// of a Link header, or that would confuse parsers that split links and parameters.
+func escapeLinkTarget(url string) string {
+	var b strings.Builder
+	for i := range len(url) {
+		if c := url[i]; c <= ' ' || c >= 0x7f || strings.IndexByte(`<>,;"`, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isToken reports whether s is a token, as defined by RFC 9110.
+func isToken(s string) bool {
+	return s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	})
+}
+
+// SendEarlyHints sends a 103 Early Hints response with the headers set so far, like the Link headers
+// added by [Preload], so that browsers can fetch resources while the procedure is still running.
+//
+// Remote procedures ignore early hints. Outside of a served procedure SendEarlyHints is a no-op.
+func SendEarlyHints(ctx context.Context) {
+	if send, ok := ctx.Value(earlyHintsKey{}).(func()); ok {
+		send()
+	}
+}
+
+// ContentTypeFromContext returns the Content-Type of the message being decoded.
+//
+// It is meant to be used by [Codec.Dec] implementations that need the media type parameters,
+// for example the multipart boundary.
+func ContentTypeFromContext(ctx context.Context) string {
+	ct, _ := ctx.Value(contentTypeKey{}).(string)
+	return ct
+}
+
+func withContentType(ctx context.Context, ct string) context.Context {
+	return context.WithValue(ctx, contentTypeKey{}, ct)
+}
+
+// cleanups is a list of functions to call once a request has been fully served.
+type cleanups struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// withCleanups returns a context that collects cleanups registered with [onCleanup],
+// and a function that runs them in reverse order.
+func withCleanups(ctx context.Context) (context.Context, func()) {
+	c := &cleanups{}
+	return context.WithValue(ctx, cleanupsKey{}, c), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, f := range slices.Backward(c.fns) {
+			f()
+		}
+		c.fns = nil
+	}
+}
+
+// onCleanup registers f to be called once the current request has been served.
+//
+// It reports false if ctx does not belong to a request served by [Endpoint.Register].
+func onCleanup(ctx context.Context, f func()) bool {
+	c, ok := ctx.Value(cleanupsKey{}).(*cleanups)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fns = append(c.fns, f)
+	return true
+}
+
+// ResponseInfo describes the response to a call, see [WithResponseInfo].
+type ResponseInfo struct {
+	// Status is the HTTP status of the response, for example 201 for resources that were created.
+	Status int
+	Header http.Header
+}
+
+// WithResponseInfo returns a context that makes remote procedures fill info with the status and header
+// of the response they receive, including responses that make them fail.
+//
+// info is left untouched if no response was received.
+func WithResponseInfo(ctx context.Context, info *ResponseInfo) context.Context {
+	o := callOptionsFromContext(ctx)
+	o.info = info
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// WithResponseHook returns a context that makes remote procedures call hook with the HTTP response
+// they receive, including responses that make them fail, before decoding it.
+//
+// It is an escape hatch for clients that need details that are not exposed otherwise.
+// hook must not read or close the body. Trailers are only available once the body is consumed,
+// which for codecs that don't keep streams open happens before the call returns.
+// Calls with a hook are never coalesced, see [WithCoalescing].
+func WithResponseHook(ctx context.Context, hook func(*http.Response)) context.Context {
+	o := callOptionsFromContext(ctx)
+	o.hook = hook
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
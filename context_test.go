@@ -0,0 +1,225 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestIfMatch(t *testing.T) {
+	ctx := tst.Go(t)
+	var (
+		mu   sync.Mutex
+		etag = `"v1"`
+		val  = "initial"
+	)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPut, "/resource")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if srpc.IfMatchFromContext(ctx) != etag {
+			return Resp{}, srpc.PreconditionFailed("stale resource")
+		}
+		val = req.B
+		etag = `"v2"`
+		srpc.ResponseHeader(ctx).Set("ETag", etag)
+		return Resp{val}, nil
+	})
+	c := ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))
+
+	got := tst.Do(c(srpc.WithIfMatch(ctx, `"v1"`), Req{"updated"}))(t)
+	tst.Is(Resp{"updated"}, got, t)
+
+	_, err := c(srpc.WithIfMatch(ctx, `"v1"`), Req{"lost update"})
+	tst.Is(true, srpc.IsPreconditionFailed(err), t)
+
+	_, err = c(ctx, Req{"blind update"})
+	tst.Is(true, srpc.IsPreconditionFailed(err), t)
+	tst.Is("updated", val, t)
+}
+
+func TestHeadersInContext(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/tenant")
+	handler := func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.HeaderFromContext(ctx, "x-tenant") + "|" + srpc.HeaderFromContext(ctx, "Authorization")}, nil
+	}
+	ep.Register(mux, handler, srpc.WithHeadersInContext("X-Tenant"))
+
+	t.Run("Served", func(t *testing.T) {
+		c := ep.Remote(tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-Tenant", "acme")
+			r.Header.Set("Authorization", "secret")
+			mux.ServeHTTP(w, r)
+		})))(t))
+		got := tst.Do(c(ctx, Req{}))(t)
+		tst.Is(Resp{"acme|"}, got, t)
+	})
+
+	t.Run("Direct", func(t *testing.T) {
+		got := tst.Do(handler(srpc.ContextWithHeader(ctx, "X-Tenant", "test"), Req{}))(t)
+		tst.Is(Resp{"test|"}, got, t)
+	})
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/lang")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{strings.Join(srpc.AcceptLanguageFromContext(ctx), " ")}, nil
+	})
+	tr := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithDefaultAcceptLanguage("it-IT", "it", "en")))(t)
+	c := ep.Remote(tr)
+
+	t.Run("Default", func(t *testing.T) {
+		got := tst.Do(c(ctx, Req{}))(t)
+		tst.Is(Resp{"it-IT it en"}, got, t)
+	})
+	t.Run("PerCall", func(t *testing.T) {
+		got := tst.Do(c(srpc.WithAcceptLanguage(ctx, "fr", "de"), Req{}))(t)
+		tst.Is(Resp{"fr de"}, got, t)
+	})
+	t.Run("Weights", func(t *testing.T) {
+		raw := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Accept-Language", "en;q=0.5, fr-CH, fr;q=0.9, de;q=0, *;q=0.1")
+			mux.ServeHTTP(w, r)
+		})))(t)
+		got := tst.Do(ep.Remote(raw)(ctx, Req{}))(t)
+		tst.Is(Resp{"fr-CH fr en *"}, got, t)
+	})
+}
+
+func TestPropagatedTimeout(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/deadline")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		dl, ok := ctx.Deadline()
+		if !ok {
+			return Resp{"none"}, nil
+		}
+		if time.Until(dl) > time.Minute {
+			return Resp{"long"}, nil
+		}
+		return Resp{"short"}, nil
+	}, srpc.WithPropagatedTimeout(time.Minute))
+	c := ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))
+
+	got := tst.Do(c(ctx, Req{}))(t)
+	tst.Is(Resp{"none"}, got, t)
+
+	sctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	got = tst.Do(c(sctx, Req{}))(t)
+	tst.Is(Resp{"short"}, got, t)
+
+	lctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	got = tst.Do(c(lctx, Req{}))(t)
+	tst.Is(Resp{"short"}, got, t)
+}
+
+func TestPatternFromContext(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/users/{id}")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.PatternFromContext(ctx)}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	got := tst.Do(ep.Remote(conn)(srpc.WithPathValue(ctx, "id", "42"), Req{}))(t)
+	tst.Is(Resp{"GET /users/{id}"}, got, t)
+	tst.Is("", srpc.PatternFromContext(ctx), t)
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	ctx := tst.Go(t)
+	type User struct{ Name string }
+	auth := srpc.AuthenticatorFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		return srpc.ContextWithIdentity(ctx, User{r.Header.Get("X-User")}), nil
+	})
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		u, ok := srpc.IdentityFromContext[User](ctx)
+		if !ok {
+			return Resp{}, srpc.Unauthorized("no identity")
+		}
+		_, ok = srpc.IdentityFromContext[string](ctx)
+		return Resp{u.Name + strconv.FormatBool(ok)}, nil
+	}, srpc.WithAuthenticator(auth))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	got := tst.Do(Ep.Remote(conn)(srpc.WithCallHeader(ctx, "X-User", "alice"), Req{}))(t)
+	tst.Is(Resp{"alicefalse"}, got, t)
+
+	_, ok := srpc.IdentityFromContext[User](ctx)
+	tst.Is(false, ok, t)
+}
+
+func TestDecodeTimeout(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/slow")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	}, srpc.WithDecodeTimeout(50*time.Millisecond))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	// slow sends the request body as is, without encoding it.
+	slow := srpc.NewEndpoint(http.MethodPost, "/slow", srpc.NewCodecJSON[Resp](), srpc.NewCodecRawBody("application/json", 16))
+
+	for name, conn := range map[string]*srpc.Transport{
+		"InMemory": tst.Do(srpc.NewInMemoryTransport(mux))(t),
+		"HTTP":     tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := tst.Do(ep.Remote(conn)(ctx, Req{"fast"}))(t)
+			tst.Is(Resp{"fast"}, got, t)
+
+			pr, pw := io.Pipe()
+			defer func() { tst.No(pw.Close(), t) }()
+			go func() { _, _ = pw.Write([]byte(`{"B":`)) }()
+			_, err := slow.Remote(conn)(ctx, srpc.NewRawBody(pr, ""))
+			werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+			tst.Is(http.StatusRequestTimeout, werr.Code, t)
+			tst.Is("Request timeout.", werr.Msg, t)
+		})
+	}
+}
+
+func TestPropagators(t *testing.T) {
+	ctx := tst.Go(t)
+	tenant := srpc.HeaderPropagator("X-Tenant")
+
+	// Backend is called by the frontend.
+	backendMux := http.NewServeMux()
+	backend := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/backend")
+	backend.Register(backendMux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B + " for " + srpc.PropagatedValue(ctx, "x-tenant")}, nil
+	}, srpc.WithPropagators(tenant))
+	callBackend := backend.Remote(tst.Do(srpc.NewInMemoryTransport(backendMux, srpc.WithClientPropagators(tenant)))(t))
+
+	frontendMux := http.NewServeMux()
+	frontend := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/frontend")
+	frontend.Register(frontendMux, func(ctx context.Context, req Req) (Resp, error) {
+		return callBackend(ctx, req)
+	}, srpc.WithPropagators(tenant))
+	callFrontend := frontend.Remote(tst.Do(srpc.NewInMemoryTransport(frontendMux, srpc.WithClientPropagators(tenant)))(t))
+
+	got := tst.Do(callFrontend(srpc.WithPropagatedValue(ctx, "X-Tenant", "acme"), Req{"report"}))(t)
+	tst.Is(Resp{"report for acme"}, got, t)
+	got = tst.Do(callFrontend(ctx, Req{"report"}))(t)
+	tst.Is(Resp{"report for "}, got, t)
+}
@@ -0,0 +1,125 @@
+package srpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"slices"
+	"time"
+)
+
+// SetCookie adds a Set-Cookie header to the response, for example to start a session.
+//
+// To clear a cookie set one with the same name and path, and a negative MaxAge.
+// Invalid cookies are dropped.
+func SetCookie(ctx context.Context, c *http.Cookie) {
+	if v := c.String(); v != "" {
+		ResponseHeader(ctx).Add("Set-Cookie", v)
+	}
+}
+
+// RequestCookie returns the named cookie of the request being served, or [http.ErrNoCookie].
+func RequestCookie(ctx context.Context, name string) (*http.Cookie, error) {
+	r := requestFromContext(ctx)
+	if r == nil {
+		return nil, http.ErrNoCookie
+	}
+	return r.Cookie(name)
+}
+
+// WithCookieCapture makes the transport store the cookies set by responses, and send them
+// with the following requests in place of the cookies with the same name.
+//
+// Cookies are kept for the whole origin, regardless of their domain and path, until they expire
+// or are cleared by the server.
+func WithCookieCapture() TransportOption {
+	return func(t *Transport) { t.captureCookies = true }
+}
+
+// requestCookies returns the cookies to send with requests.
+func (t *Transport) requestCookies() []*http.Cookie {
+	t.cookieMu.Lock()
+	defer t.cookieMu.Unlock()
+	now := time.Now()
+	return slices.DeleteFunc(slices.Clone(t.cookies), func(c *http.Cookie) bool {
+		return !c.Expires.IsZero() && c.Expires.Before(now)
+	})
+}
+
+// storeCookies stores the cookies set by resp, if the transport captures cookies.
+func (t *Transport) storeCookies(resp *http.Response) {
+	set := resp.Cookies()
+	if !t.captureCookies || len(set) == 0 {
+		return
+	}
+	t.cookieMu.Lock()
+	defer t.cookieMu.Unlock()
+	for _, c := range set {
+		t.cookies = slices.DeleteFunc(slices.Clone(t.cookies), func(old *http.Cookie) bool { return old.Name == c.Name })
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			continue
+		}
+		if c.MaxAge > 0 {
+			c.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		t.cookies = append(t.cookies, &http.Cookie{Name: c.Name, Value: c.Value, Quoted: c.Quoted, Expires: c.Expires})
+	}
+}
+
+// WithCookieJar makes the transport store cookies set by responses in jar, and send them with
+// the following requests according to their domain, path and expiration. If jar is nil, a new
+// in-memory jar is used.
+//
+// Unlike [WithCookieCapture], it follows the cookie rules of browsers. Transports created with
+// [Transport.Clone] share the jar, unless they are given their own.
+func WithCookieJar(jar http.CookieJar) TransportOption {
+	return func(t *Transport) {
+		if jar == nil {
+			jar, _ = cookiejar.New(nil)
+		}
+		t.jar = jar
+	}
+}
+
+// withJar returns a copy of cl that uses jar, or cl itself if it already does.
+func withJar(cl *http.Client, jar http.CookieJar) *http.Client {
+	if jar == nil || cl.Jar == jar {
+		return cl
+	}
+	c := *cl
+	c.Jar = jar
+	return &c
+}
+
+// WithCallCookie returns a context that makes remote procedures send c.
+//
+// Cookies are merged by name. In increasing order of precedence, requests carry:
+//   - the cookies of the transport, passed to [NewTransport] or set with [WithCookies] and [WithCookieCapture];
+//   - the cookies in the Cookie header set with [WithHeaders] or [WithCallHeader];
+//   - the cookies set with WithCallCookie.
+//
+// Cookies stored in the jar of [WithCookieJar] are added by the [http.Client] and are not merged.
+func WithCallCookie(ctx context.Context, c *http.Cookie) context.Context {
+	o := callOptionsFromContext(ctx)
+	o.cookies = append(slices.Clip(o.cookies), c)
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// setCookies replaces the Cookie header of r with the merge of layers, where cookies
+// of later layers replace the ones with the same name of earlier layers.
+func setCookies(r *http.Request, layers ...[]*http.Cookie) {
+	var merged []*http.Cookie
+	for _, layer := range layers {
+		for _, c := range layer {
+			if i := slices.IndexFunc(merged, func(m *http.Cookie) bool { return m.Name == c.Name }); i >= 0 {
+				merged[i] = c
+				continue
+			}
+			merged = append(merged, c)
+		}
+	}
+	r.Header.Del("Cookie")
+	for _, c := range merged {
+		r.AddCookie(c)
+	}
+}
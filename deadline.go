@@ -0,0 +1,79 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TimeoutHeader carries the time, in milliseconds, that the client is willing to wait for a response.
+//
+// It is sent by clients calling procedures with a context that has a deadline, and honored by
+// servers configured with [WithPropagatedTimeout].
+const TimeoutHeader = "Srpc-Timeout-Ms"
+
+// setTimeoutHeader sets the [TimeoutHeader] on r if ctx has a deadline.
+func setTimeoutHeader(ctx context.Context, r *http.Request) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	ms := max(time.Until(dl).Milliseconds(), 1)
+	r.Header.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+}
+
+// WithPropagatedTimeout makes endpoints apply the timeout sent by clients in the [TimeoutHeader]
+// to the context of procedures, so that they can stop working on requests that clients gave up on.
+//
+// Timeouts are capped at limit, invalid or non-positive values are ignored.
+func WithPropagatedTimeout(limit time.Duration) ServerOption {
+	return func(c *serverConfig) { c.maxTimeout = limit }
+}
+
+// withPropagatedTimeout returns a context that expires according to the [TimeoutHeader] of r, capped at limit.
+func withPropagatedTimeout(ctx context.Context, r *http.Request, limit time.Duration) (context.Context, context.CancelFunc) {
+	ms, err := strconv.ParseInt(r.Header.Get(TimeoutHeader), 10, 64)
+	if limit <= 0 || err != nil || ms <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, min(time.Duration(ms)*time.Millisecond, limit))
+}
+
+// WithDecodeTimeout makes endpoints respond with 408 Request Timeout to requests that can't be decoded within d,
+// which protects servers from clients that send their requests slowly.
+//
+// Pending reads are aborted with a read deadline on the connection or, if it doesn't support it,
+// by closing the request body. The timeout only covers decoding: request bodies that are streamed to procedures,
+// like the ones of [NewCodecRawBody], are read without it.
+func WithDecodeTimeout(d time.Duration) ServerOption {
+	return func(c *serverConfig) { c.decodeTimeout = d }
+}
+
+// decodeTimer aborts reading a request body once the decode timeout expires.
+type decodeTimer struct {
+	rc    *http.ResponseController
+	timer *time.Timer
+}
+
+// startDecodeTimer starts the decode timeout of the request with the given body, which is served by w.
+func startDecodeTimer(w http.ResponseWriter, body io.Closer, d time.Duration) *decodeTimer {
+	t := &decodeTimer{rc: http.NewResponseController(w)}
+	_ = t.rc.SetReadDeadline(time.Now().Add(d))
+	t.timer = time.AfterFunc(d, func() { _ = body.Close() })
+	return t
+}
+
+// stop stops the timer and reports whether err, returned by the decoder, was caused by the timeout.
+// It is a no-op on a nil timer.
+func (t *decodeTimer) stop(err error) bool {
+	if t == nil {
+		return false
+	}
+	expired := !t.timer.Stop()
+	_ = t.rc.SetReadDeadline(time.Time{})
+	return err != nil && (expired || errors.Is(err, os.ErrDeadlineExceeded))
+}
@@ -0,0 +1,78 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrTransportDraining is returned by calls issued on a [Transport] that is being drained with [Transport.Drain].
+var ErrTransportDraining = errors.New("transport is draining")
+
+// inflight tracks the calls in flight on a [Transport].
+type inflight struct {
+	mu       sync.Mutex
+	n        int
+	draining bool
+	// idle is closed when n drops to zero, if not nil.
+	idle chan struct{}
+}
+
+// start records a new call, it fails if the transport is draining.
+func (f *inflight) start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return ErrTransportDraining
+	}
+	f.n++
+	return nil
+}
+
+// done records the end of a call.
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// wait blocks until there are no calls in flight or ctx is done, if drain is set new calls are rejected.
+func (f *inflight) wait(ctx context.Context, drain bool) error {
+	f.mu.Lock()
+	f.draining = f.draining || drain
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain makes the transport reject new calls with [ErrTransportDraining], and waits for the ones
+// in flight to return or for ctx to be done, in which case it returns the context error.
+//
+// It is meant to be called on shutdown, so that calls that might mutate state are not interrupted.
+// Calls are in flight until they return: streamed responses are not waited for.
+// Copies made with [Transport.Clone] are tracked separately.
+func (t *Transport) Drain(ctx context.Context) error {
+	return t.inflight.wait(ctx, true)
+}
+
+// Wait is like [Transport.Drain], but it doesn't reject new calls.
+func (t *Transport) Wait(ctx context.Context) error {
+	return t.inflight.wait(ctx, false)
+}
@@ -0,0 +1,274 @@
+package srpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+var (
+	_ ErrorResponse = &WireError{}
+	_ error         = &WireError{}
+)
+
+// WireError is an error that can be sent over the wire.
+//
+// It allows to set HTTP status and message.
+type WireError struct {
+	Msg  string
+	Code int
+
+	// redirect is set for errors caused by unexpected redirects.
+	redirect *Redirect
+	// kind is the [ErrorKindHeader] of the response.
+	kind string
+	// endpointNotFound is set for 404 responses that were not sent by an endpoint.
+	endpointNotFound bool
+	// truncated is set if Msg was truncated to the limit set with [WithMaxResponseBytes].
+	truncated bool
+}
+
+// Error implements [error].
+func (w *WireError) Error() string {
+	return fmt.Sprintf("%v %v: %v", w.Code, http.StatusText(w.Code), w.Msg)
+}
+
+// Message implements [ErrorResponse].
+func (w *WireError) Message() string { return w.Msg }
+
+// Status implements [ErrorResponse].
+func (w *WireError) Status() int { return w.Code }
+
+// Unwrap returns the [*Redirect] that caused the error, if any.
+func (w *WireError) Unwrap() error {
+	if w.redirect == nil {
+		return nil
+	}
+	return w.redirect
+}
+
+// Is reports whether target is the sentinel error for the status of w, for example:
+//
+//	errors.Is(err, srpc.ErrNotFound)
+//
+// is true for errors returned by calls that failed with 404 Not Found.
+// It also matches [ErrServerPanic] for calls whose procedure panicked, [ErrEndpointNotFound]
+// for calls to endpoints that the server doesn't have, and [ErrResponseTooLarge] for errors
+// whose message was truncated.
+func (w *WireError) Is(target error) bool {
+	switch target { //nolint: errorlint // target is the one being matched.
+	case ErrServerPanic:
+		return w.kind == panicKind
+	case ErrEndpointNotFound:
+		return w.endpointNotFound
+	case ErrResponseTooLarge:
+		return w.truncated
+	}
+	s, ok := target.(statusError)
+	return ok && int(s) == w.Code
+}
+
+// statusError is the type of sentinel errors that represent HTTP statuses.
+type statusError int
+
+// Error implements [error].
+func (s statusError) Error() string { return fmt.Sprintf("%d %s", int(s), http.StatusText(int(s))) }
+
+// Message implements [ErrorResponse].
+func (s statusError) Message() string { return "" }
+
+// Status implements [ErrorResponse].
+func (s statusError) Status() int { return int(s) }
+
+// Sentinel errors for common statuses.
+//
+// Errors returned by remote procedures match the one of their status with [errors.Is].
+// Procedures can also return them, or wrap them, to respond with their status.
+var (
+	ErrBadRequest         error = statusError(http.StatusBadRequest)
+	ErrUnauthorized       error = statusError(http.StatusUnauthorized)
+	ErrForbidden          error = statusError(http.StatusForbidden)
+	ErrNotFound           error = statusError(http.StatusNotFound)
+	ErrConflict           error = statusError(http.StatusConflict)
+	ErrPreconditionFailed error = statusError(http.StatusPreconditionFailed)
+	ErrTooManyRequests    error = statusError(http.StatusTooManyRequests)
+	ErrInternal           error = statusError(http.StatusInternalServerError)
+	ErrServiceUnavailable error = statusError(http.StatusServiceUnavailable)
+	ErrGatewayTimeout     error = statusError(http.StatusGatewayTimeout)
+)
+
+// notFoundKind is the [ErrorKindHeader] value of 404 responses sent by endpoints, which tells them apart
+// from the ones of servers that don't have the endpoint.
+const notFoundKind = "not-found"
+
+// ErrEndpointNotFound matches, with [errors.Is], the errors returned by remote procedures whose
+// server responded 404 Not Found without reaching the endpoint, for example because it is not deployed yet.
+//
+// These errors also match [ErrNotFound], like the ones of procedures that respond 404 because
+// the requested resource doesn't exist, which don't match ErrEndpointNotFound.
+// The two can only be told apart for servers that use this version of the package or a later one.
+var ErrEndpointNotFound = errors.New("endpoint not found")
+
+// errorStatus returns the status and message to send to the client for err.
+//
+// If err does not implement [ErrorResponse] the fallback status is used.
+func errorStatus(err error, fallback int) (int, string) {
+	status := fallback
+	var msg string
+	var serr ErrorResponse
+	if errors.As(err, &serr) {
+		status = serr.Status()
+		msg = serr.Message()
+	}
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	return status, msg
+}
+
+// readErr returns the error carried by resp, and closes its body.
+//
+// Bodies larger than the limit set with [WithMaxResponseBytes] are truncated to it.
+func readErr(resp *http.Response) error {
+	defer func() { _ = resp.Body.Close() }()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil && !errors.Is(err, ErrResponseTooLarge) {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return &WireError{
+			Code:     resp.StatusCode,
+			Msg:      fmt.Sprintf("unexpected redirect to %q", loc),
+			redirect: &Redirect{Location: loc, Code: resp.StatusCode},
+		}
+	}
+	if v, ok := readValidationError(resp, buf); ok {
+		return v
+	}
+	we := &WireError{Code: resp.StatusCode, Msg: string(bytes.TrimSpace(buf)), truncated: err != nil}
+	we.kind = resp.Header.Get(ErrorKindHeader)
+	we.endpointNotFound = resp.StatusCode == http.StatusNotFound && we.kind == ""
+	return we
+}
+
+// Redirect is an error that procedures can return to redirect the client to Location.
+//
+// Calls that are redirected fail with a [*WireError] that wraps a Redirect, unless the transport
+// was created with [WithFollowRedirects]. Callers can get the location with [errors.As].
+type Redirect struct {
+	Location string
+	// Code is the redirect status, it defaults to 302 Found.
+	Code int
+}
+
+// Error implements [error].
+func (r *Redirect) Error() string { return fmt.Sprintf("redirect to %q", r.Location) }
+
+func (r *Redirect) status() int {
+	if r.Code == 0 {
+		return http.StatusFound
+	}
+	return r.Code
+}
+
+// NewWireError returns a [WireError] with the given HTTP status code and message.
+func NewWireError(code int, msg string) *WireError {
+	return &WireError{Msg: msg, Code: code}
+}
+
+// BadRequest returns a [WireError] with status 400 and the given message.
+func BadRequest(msg string) *WireError { return NewWireError(http.StatusBadRequest, msg) }
+
+// Unauthorized returns a [WireError] with status 401 and the given message.
+func Unauthorized(msg string) *WireError { return NewWireError(http.StatusUnauthorized, msg) }
+
+// Forbidden returns a [WireError] with status 403 and the given message.
+func Forbidden(msg string) *WireError { return NewWireError(http.StatusForbidden, msg) }
+
+// NotFound returns a [WireError] with status 404 and the given message.
+func NotFound(msg string) *WireError { return NewWireError(http.StatusNotFound, msg) }
+
+// PreconditionFailed returns a [WireError] with status 412 and the given message.
+func PreconditionFailed(msg string) *WireError {
+	return NewWireError(http.StatusPreconditionFailed, msg)
+}
+
+// IsBadRequest reports whether err carries a 400 status.
+func IsBadRequest(err error) bool { return hasStatus(err, http.StatusBadRequest) }
+
+// IsUnauthorized reports whether err carries a 401 status.
+func IsUnauthorized(err error) bool { return hasStatus(err, http.StatusUnauthorized) }
+
+// IsForbidden reports whether err carries a 403 status.
+func IsForbidden(err error) bool { return hasStatus(err, http.StatusForbidden) }
+
+// IsNotFound reports whether err carries a 404 status.
+func IsNotFound(err error) bool { return hasStatus(err, http.StatusNotFound) }
+
+// IsPreconditionFailed reports whether err carries a 412 status.
+func IsPreconditionFailed(err error) bool { return hasStatus(err, http.StatusPreconditionFailed) }
+
+// hasStatus reports whether any error in err's tree is an [ErrorResponse] with the given status.
+func hasStatus(err error, code int) bool {
+	var er ErrorResponse
+	return errors.As(err, &er) && er.Status() == code
+}
+
+// decodeErrorDetail describes why a request could not be decoded.
+//
+// For JSON type errors it reports the path of the offending field and the expected type.
+func decodeErrorDetail(err error) string {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		field := te.Field
+		if field == "" {
+			field = "(root)"
+		}
+		return fmt.Sprintf("field %q: cannot use JSON %s as %s", field, te.Value, te.Type)
+	}
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return fmt.Sprintf("invalid JSON at offset %d: %v", se.Offset, se)
+	}
+	return err.Error()
+}
+
+// Trailers that report errors that happen after the response status was sent.
+const (
+	statusTrailer  = "Srpc-Status"
+	messageTrailer = "Srpc-Message"
+)
+
+// setErrorTrailers reports err, which happened while sending the response body, in the trailers.
+func setErrorTrailers(w http.ResponseWriter, err error) {
+	status, msg := errorStatus(err, http.StatusInternalServerError)
+	w.Header().Set(http.TrailerPrefix+statusTrailer, strconv.Itoa(status))
+	w.Header().Set(http.TrailerPrefix+messageTrailer, msg)
+}
+
+// trailerReader is a response body that converts errors reported in the trailers
+// into read errors once the body is fully read.
+type trailerReader struct {
+	io.ReadCloser
+	resp *http.Response
+}
+
+func (r *trailerReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+	st := r.resp.Trailer.Get(statusTrailer)
+	if st == "" {
+		return n, err
+	}
+	code, cerr := strconv.Atoi(st)
+	if cerr != nil {
+		return n, fmt.Errorf("invalid %s trailer: %q", statusTrailer, st)
+	}
+	return n, &WireError{Code: code, Msg: r.resp.Trailer.Get(messageTrailer)}
+}
@@ -0,0 +1,125 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestWireErrorHelpers(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/helpers")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		switch req.B {
+		case "missing":
+			return Resp{}, srpc.NotFound("no such thing")
+		case "anon":
+			return Resp{}, fmt.Errorf("wrapped: %w", srpc.Unauthorized("log in first"))
+		default:
+			return Resp{}, srpc.NewWireError(http.StatusTeapot, "teapot")
+		}
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	c := ep.Remote(conn)
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := c(ctx, Req{"missing"})
+		tst.Is(true, srpc.IsNotFound(err), t)
+		tst.Is(false, srpc.IsUnauthorized(err), t)
+		werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+		tst.Is("no such thing", werr.Msg, t)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := c(ctx, Req{"anon"})
+		tst.Is(true, srpc.IsUnauthorized(err), t)
+		tst.Is(false, srpc.IsNotFound(err), t)
+	})
+
+	t.Run("Other", func(t *testing.T) {
+		_, err := c(ctx, Req{"other"})
+		tst.Is(false, srpc.IsNotFound(err), t)
+		tst.Is(false, srpc.IsBadRequest(err), t)
+		tst.Is(false, srpc.IsNotFound(nil), t)
+	})
+}
+
+func TestDebugErrors(t *testing.T) {
+	type Typed struct {
+		Inner struct {
+			N int `json:"n"`
+		} `json:"inner"`
+	}
+	ep := srpc.NewEndpointJSON[Resp, Typed](http.MethodPost, "/typed")
+	proc := func(ctx context.Context, req Typed) (Resp, error) { return Resp{}, nil }
+
+	tcs := []struct {
+		name string
+		opts []srpc.ServerOption
+		body string
+		want string
+	}{
+		{name: "Default", body: `{"inner":{"n":"x"}}`, want: "Unable to decode request.\n"},
+		{
+			name: "Type", opts: []srpc.ServerOption{srpc.WithDebugErrors()}, body: `{"inner":{"n":"x"}}`,
+			want: "Unable to decode request: field \"inner.n\": cannot use JSON string as int\n",
+		},
+		{
+			name: "Syntax", opts: []srpc.ServerOption{srpc.WithDebugErrors()}, body: `{"inner":`,
+			want: "Unable to decode request: unexpected EOF\n",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			ep.Register(mux, proc, tc.opts...)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(tst.Go(t), http.MethodPost, "/typed", strings.NewReader(tc.body))
+			mux.ServeHTTP(rec, req)
+			tst.Is(http.StatusBadRequest, rec.Code, t)
+			tst.Is(tc.want, rec.Body.String(), t)
+		})
+	}
+}
+
+func TestSentinels(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "sentinel" {
+			return Resp{}, fmt.Errorf("lookup: %w", srpc.ErrConflict)
+		}
+		return Resp{}, srpc.NotFound("gone")
+	})
+	c := Ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))
+
+	_, err := c(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrNotFound), t)
+	tst.Is(false, errors.Is(err, srpc.ErrForbidden), t)
+
+	_, err = c(ctx, Req{"sentinel"})
+	tst.Is(true, errors.Is(err, srpc.ErrConflict), t)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is("Conflict", werr.Msg, t)
+}
+
+func TestRedirect(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{}, &srpc.Redirect{Location: "https://auth.example.com/login"}
+	})
+	_, err := Ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))(ctx, Req{})
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusFound, werr.Code, t)
+	rd := tst.DoB(errors.AsType[*srpc.Redirect](err))(t)
+	tst.Is("https://auth.example.com/login", rd.Location, t)
+}
@@ -9,5 +9,30 @@ import (
 var ParseSSE = parseSSE
 
 func SeqWriterTo[T any](ctx context.Context, seq iter.Seq2[T, error]) io.WriterTo {
-	return &wireSeq[T]{seq: seq}
+	return &wireSeq[T]{ctx: ctx, seq: seq}
 }
+
+var ParseRetryAfter = parseRetryAfter
+
+var CopyContext = copyContext
+
+var NegotiateEncoding = negotiateEncoding
+
+// FlightWaiters returns the number of callers waiting for coalesced calls of conn.
+func FlightWaiters(conn *Transport) int {
+	conn.flights.mu.Lock()
+	defer conn.flights.mu.Unlock()
+	var n int
+	for _, f := range conn.flights.flights {
+		n += f.waiters
+	}
+	return n
+}
+
+// NewBreaker returns the functions that transports created with [WithCircuitBreaker] call around requests.
+func NewBreaker(cb CircuitBreaker) (allow func() (bool, error), done func(probe, counted, failed bool)) {
+	b := &breaker{cfg: cb}
+	return b.allow, b.done
+}
+
+var SameMediaType = sameMediaType
@@ -0,0 +1,74 @@
+package srpc
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HealthStatus is the response of health endpoints registered with [RegisterReadiness].
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthCheck reports whether a dependency of the service is ready to be used.
+type HealthCheck func(ctx context.Context) error
+
+// RegisterHealth registers on m a GET endpoint at path, usually "/healthz", that returns
+// the value produced by status.
+//
+// It is meant for liveness probes, so status should not depend on other services.
+func RegisterHealth[T any](m Mux, path string, status func(ctx context.Context) T, opts ...ServerOption) {
+	ep := EndpointR[T](NewEndpointJSON[T, struct{}](http.MethodGet, path))
+	ep.Register(m, func(ctx context.Context) (T, error) {
+		return status(ctx), nil
+	}, opts...)
+}
+
+// RegisterReadiness registers on m a GET endpoint at path, usually "/readyz", that runs all checks
+// concurrently.
+//
+// If all checks pass it returns a [HealthStatus] with status "ok", otherwise it responds with
+// 503 Service Unavailable and a message that lists the names of the failed checks.
+// The errors of the checks are logged, not sent, as they can reveal details about the infrastructure.
+func RegisterReadiness(m Mux, path string, checks map[string]HealthCheck, opts ...ServerOption) {
+	ep := EndpointR[HealthStatus](NewEndpointJSON[HealthStatus, struct{}](http.MethodGet, path))
+	ep.Register(m, func(ctx context.Context) (HealthStatus, error) {
+		var (
+			mu   sync.Mutex
+			errs = map[string]error{}
+			wg   sync.WaitGroup
+		)
+		for name, check := range checks {
+			wg.Go(func() {
+				if err := check(ctx); err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					errs[name] = err
+				}
+			})
+		}
+		wg.Wait()
+
+		if len(errs) > 0 {
+			var msgs []string
+			for _, name := range slices.Sorted(maps.Keys(errs)) {
+				slog.LogAttrs(ctx, slog.LevelWarn, "Readiness check failed",
+					slog.String("check", name),
+					slog.String("error", errs[name].Error()))
+				msgs = append(msgs, name+": failed")
+			}
+			return HealthStatus{}, NewWireError(http.StatusServiceUnavailable, "Not ready: "+strings.Join(msgs, "; "))
+		}
+		st := HealthStatus{Status: "ok", Checks: map[string]string{}}
+		for name := range checks {
+			st.Checks[name] = "ok"
+		}
+		return st, nil
+	}, opts...)
+}
@@ -0,0 +1,37 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	srpc.RegisterHealth(mux, "/healthz", func(context.Context) Resp { return Resp{"alive"} })
+	var dbErr error
+	srpc.RegisterReadiness(mux, "/readyz", map[string]srpc.HealthCheck{
+		"cache": func(context.Context) error { return nil },
+		"db":    func(context.Context) error { return dbErr },
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	health := srpc.EndpointR[Resp](srpc.NewEndpointJSON[Resp, struct{}](http.MethodGet, "/healthz"))
+	got := tst.Do(health.Remote(conn)(ctx))(t)
+	tst.Is(Resp{"alive"}, got, t)
+
+	ready := srpc.EndpointR[srpc.HealthStatus](srpc.NewEndpointJSON[srpc.HealthStatus, struct{}](http.MethodGet, "/readyz"))
+	st := tst.Do(ready.Remote(conn)(ctx))(t)
+	tst.Is(srpc.HealthStatus{Status: "ok", Checks: map[string]string{"cache": "ok", "db": "ok"}}, st, t)
+
+	dbErr = errors.New("connection refused")
+	_, err := ready.Remote(conn)(ctx)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusServiceUnavailable, werr.Code, t)
+	tst.Is("Not ready: db: failed", werr.Msg, t)
+}
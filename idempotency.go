@@ -0,0 +1,365 @@
+package srpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header that carries the key used to deduplicate retried calls.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that were replayed from an [IdempotencyStore].
+const ReplayedHeader = "Idempotent-Replayed"
+
+// WithIdempotencyKey returns a context that makes remote procedures send key in the [IdempotencyKeyHeader].
+//
+// Calls with the same key are served at most once by servers that use [WithIdempotency].
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return WithCallHeader(ctx, IdempotencyKeyHeader, key)
+}
+
+// WithIdempotencyKeys makes the transport send a random key in the [IdempotencyKeyHeader] with every call
+// to endpoints with a method that is not idempotent, unless one was set with [WithIdempotencyKey].
+//
+// The key is the same for all the attempts of a call, so when combined with [WithRetry] these calls are
+// retried as well.
+func WithIdempotencyKeys() TransportOption {
+	return func(t *Transport) { t.idempotencyKeys = true }
+}
+
+// withIdempotencyKey adds a random idempotency key to ctx, if conn is configured to send one
+// for calls with the given method and the caller didn't set one.
+func withIdempotencyKey(ctx context.Context, conn *Transport, method string) context.Context {
+	if !conn.idempotencyKeys || idempotent(method) || callOptionsFromContext(ctx).header.Get(IdempotencyKeyHeader) != "" {
+		return ctx
+	}
+	return WithIdempotencyKey(ctx, rand.Text())
+}
+
+// StoredResponse is a response kept by an [IdempotencyStore].
+type StoredResponse struct {
+	Status int
+	// Header has the headers of the response that are replayed: the ones set by the codec and the
+	// procedure, except for cookies. Headers that depend on the request, like Content-Encoding, are left out.
+	Header http.Header
+	// Body is the response body before compression, which is negotiated again for each replay.
+	Body []byte
+
+	// RequestHash identifies the request the response was sent to, requests with the same key
+	// and a different hash are rejected.
+	RequestHash []byte
+	// TooLarge is set for responses whose body was larger than 1 MiB, which is not kept:
+	// requests with the same key are rejected instead of being replayed.
+	TooLarge bool
+}
+
+// maxStoredBytes is the size of the largest response body kept for replays.
+const maxStoredBytes = 1 << 20
+
+// unstoredHeaders are the headers of responses that are not replayed: cookies must only reach
+// the first caller, the others are set again for each request.
+var unstoredHeaders = []string{"Set-Cookie", "Content-Encoding", "Content-Length", "Date", RequestIDHeader}
+
+// storedHeader returns a copy of h without the headers that are not replayed.
+func storedHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range unstoredHeaders {
+		h.Del(k)
+	}
+	if vary := slices.DeleteFunc(h.Values("Vary"), func(v string) bool {
+		return strings.EqualFold(v, "Accept-Encoding")
+	}); len(vary) > 0 {
+		h["Vary"] = vary
+	} else {
+		h.Del("Vary")
+	}
+	return h
+}
+
+// requestHash returns the hash of the URL and body of r, which identifies requests with the same idempotency key.
+func requestHash(r *http.Request, body []byte) []byte {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.URL.RequestURI()+"\n")
+	_, _ = h.Write(body)
+	return h.Sum(nil)
+}
+
+// IdempotencyStore keeps the responses of calls that carry an idempotency key.
+//
+// Keys passed to the store are scoped by endpoint.
+type IdempotencyStore interface {
+	// Reserve claims key for a request that is about to be served.
+	//
+	// If a response was saved for key it returns it and true, and the request is not served again.
+	// If key is claimed by a request that is still being served it returns an error, usually [ErrConflict].
+	Reserve(ctx context.Context, key string) (resp *StoredResponse, ok bool, err error)
+	// Save stores the response for key, which was reserved, and releases it.
+	Save(ctx context.Context, key string, resp *StoredResponse) error
+	// Release releases key without storing a response, so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// WithIdempotency makes endpoints with methods that are not idempotent deduplicate requests
+// that carry an [IdempotencyKeyHeader]: the response to the first request is saved in store and
+// replayed, with the [ReplayedHeader] set, to later requests with the same key.
+//
+// Requests are deduplicated after authentication. Responses with a 5xx status are not saved,
+// so that the request can be retried. Requests are buffered in memory, within the limit set with
+// [WithMaxRequestBytes], to tell them apart: requests that reuse a key with a different URL or body
+// are rejected with 422 Unprocessable Entity.
+// Keys are not bound to callers: clients must use unguessable keys, as the ones generated by [WithIdempotencyKeys].
+// Replays carry the headers set by the procedure except for cookies, and are compressed as negotiated
+// with each request.
+func WithIdempotency(store IdempotencyStore) ServerOption {
+	return func(c *serverConfig) { c.idempotency = store }
+}
+
+// reserveIdempotent reserves key in the store of cfg for the request r with the given hash, and returns
+// the writer to serve the request with.
+//
+// If the request must not be served it writes the response and returns false.
+func reserveIdempotent(
+	ctx context.Context, cfg serverConfig, key string, hash []byte, w http.ResponseWriter, r *http.Request,
+) (*idempotentWriter, bool) {
+	store := cfg.idempotency
+	stored, ok, err := store.Reserve(ctx, key)
+	if err != nil {
+		status, msg := errorStatus(err, http.StatusConflict)
+		slog.LogAttrs(ctx, slog.LevelInfo, "Idempotency key unavailable",
+			slog.String("error", fmt.Sprintf("reserving: %s", err)))
+		http.Error(w, msg, status)
+		return nil, false
+	}
+	switch {
+	case !ok:
+		return &idempotentWriter{ResponseWriter: w, store: store, key: key, hash: hash}, true
+	case !bytes.Equal(stored.RequestHash, hash):
+		http.Error(w, "Idempotency key already used for a different request.", http.StatusUnprocessableEntity)
+	case stored.TooLarge:
+		http.Error(w, "Idempotency key already used for a request whose response can't be replayed.", http.StatusConflict)
+	default:
+		replayStored(ctx, cfg, stored, w, r)
+	}
+	return nil, false
+}
+
+// replayStored writes stored to w, compressed as negotiated with r.
+func replayStored(ctx context.Context, cfg serverConfig, stored *StoredResponse, w http.ResponseWriter, r *http.Request) {
+	for k, v := range stored.Header {
+		w.Header()[k] = slices.Clone(v)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	var dst io.Writer = w
+	if len(cfg.encodings) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	enc, compress := negotiateEncoding(r.Header.Get("Accept-Encoding"), cfg.encodings)
+	if compress && int64(len(stored.Body)) < cfg.compressMinSize {
+		compress = false
+	}
+	if compress && len(stored.Body) > 0 {
+		cw, err := newCompressWriter(w, enc)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelWarn, "Compression Error",
+				slog.String("error", err.Error()))
+		} else {
+			dst = cw
+			defer func() { _ = cw.Close() }()
+		}
+	}
+	w.WriteHeader(stored.Status)
+	_, _ = dst.Write(stored.Body)
+}
+
+// idempotentWriter is a [http.ResponseWriter] that keeps a copy of the response to save it
+// in an [IdempotencyStore].
+type idempotentWriter struct {
+	http.ResponseWriter
+	store IdempotencyStore
+	key   string
+	hash  []byte
+
+	status   int
+	buf      bytes.Buffer
+	tooLarge bool
+	// plain is set when the body is recorded before compression by a [plainBodyWriter].
+	plain bool
+}
+
+func (w *idempotentWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotentWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if !w.plain {
+		w.record(p[:n])
+	}
+	return n, err
+}
+
+// record adds p to the stored body, unless it gets too large.
+func (w *idempotentWriter) record(p []byte) {
+	if !w.tooLarge && w.buf.Len()+len(p) > maxStoredBytes {
+		w.tooLarge = true
+		w.buf = bytes.Buffer{}
+	}
+	if !w.tooLarge {
+		w.buf.Write(p)
+	}
+}
+
+// plainBody returns a writer that writes to dst, which compresses the body to w, and records
+// the body before compression in w.
+func (w *idempotentWriter) plainBody(dst http.ResponseWriter) http.ResponseWriter {
+	w.plain = true
+	return &plainBodyWriter{ResponseWriter: dst, iw: w}
+}
+
+// plainBodyWriter is a [http.ResponseWriter] that records the body it writes in an [idempotentWriter].
+type plainBodyWriter struct {
+	http.ResponseWriter
+	iw *idempotentWriter
+}
+
+func (w *plainBodyWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.iw.record(p[:n])
+	return n, err
+}
+
+// Flush implements [http.Flusher].
+func (w *plainBodyWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows [http.ResponseController] to access the underlying writer.
+func (w *plainBodyWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Flush implements [http.Flusher].
+func (w *idempotentWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows [http.ResponseController] to access the underlying writer.
+func (w *idempotentWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// finish saves the response in the store, or releases the key if the response should not be replayed.
+func (w *idempotentWriter) finish(ctx context.Context) {
+	// Use a context that is not canceled, the key must be released even if the client went away.
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	if w.status == 0 || w.status >= http.StatusInternalServerError {
+		err = w.store.Release(ctx, w.key)
+	} else {
+		err = w.store.Save(ctx, w.key, &StoredResponse{
+			Status:      w.status,
+			Header:      storedHeader(w.Header()),
+			Body:        w.buf.Bytes(),
+			RequestHash: w.hash,
+			TooLarge:    w.tooLarge,
+		})
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Idempotency store error",
+			slog.String("error", err.Error()))
+	}
+}
+
+// memoryIdempotencyStore is an [IdempotencyStore] that keeps responses in memory.
+type memoryIdempotencyStore struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// memoryEntry is a reserved key, whose response is nil until it is saved.
+type memoryEntry struct {
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an [IdempotencyStore] that keeps responses in memory for ttl.
+//
+// It keeps at most maxEntries keys, if positive: once they are all in use, requests with new keys
+// are rejected with 503 Service Unavailable until some expire.
+//
+// It is meant for single-instance services and tests: services with many replicas need a shared store.
+func NewMemoryIdempotencyStore(ttl time.Duration, maxEntries int) IdempotencyStore {
+	return &memoryIdempotencyStore{ttl: ttl, maxEntries: maxEntries, entries: map[string]*memoryEntry{}}
+}
+
+// Reserve implements [IdempotencyStore].
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, key string) (*StoredResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && (e.resp == nil || now.Before(e.expires)) {
+		if e.resp == nil {
+			return nil, false, NewWireError(http.StatusConflict, "A request with the same idempotency key is in progress.")
+		}
+		return e.resp, true, nil
+	}
+	if s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		s.sweep(now)
+		if len(s.entries) >= s.maxEntries {
+			return nil, false, NewWireError(http.StatusServiceUnavailable, "Too many idempotency keys in use.")
+		}
+	}
+	s.entries[key] = &memoryEntry{}
+	return nil, false, nil
+}
+
+// Save implements [IdempotencyStore].
+func (s *memoryIdempotencyStore) Save(_ context.Context, key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.entries[key] = &memoryEntry{resp: resp, expires: now.Add(s.ttl)}
+	if now.Sub(s.lastSweep) > s.ttl {
+		s.sweep(now)
+	}
+	return nil
+}
+
+// sweep deletes the expired responses, s.mu must be held.
+func (s *memoryIdempotencyStore) sweep(now time.Time) {
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if e.resp != nil && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// Release implements [IdempotencyStore].
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.resp == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestIdempotency(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/charge")
+	var charges atomic.Int32
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "large" {
+			return Resp{strings.Repeat("x", 2<<20)}, nil
+		}
+		return Resp{req.B + strconv.Itoa(int(charges.Add(1)))}, nil
+	}, srpc.WithIdempotency(srpc.NewMemoryIdempotencyStore(time.Hour, 100)))
+
+	t.Run("Replay", func(t *testing.T) {
+		charges.Store(0)
+		conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+		ctx := srpc.WithIdempotencyKey(ctx, "replay")
+		first := tst.Do(ep.Remote(conn)(ctx, Req{"charge"}))(t)
+		second := tst.Do(ep.Remote(conn)(ctx, Req{"charge"}))(t)
+		tst.Is(Resp{"charge1"}, first, t)
+		tst.Is(first, second, t)
+
+		other := tst.Do(ep.Remote(conn)(srpc.WithIdempotencyKey(ctx, "other"), Req{"charge"}))(t)
+		tst.Is(Resp{"charge2"}, other, t)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		charges.Store(0)
+		// The first response is lost on the way back.
+		var lost atomic.Bool
+		flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !lost.Swap(true) {
+				mux.ServeHTTP(httptest.NewRecorder(), r)
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+		conn := tst.Do(srpc.NewInMemoryTransport(flaky, srpc.WithIdempotencyKeys(), srpc.WithRetry(srpc.RetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     func(int) time.Duration { return 0 },
+		})))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, Req{"charge"}))(t)
+		tst.Is(Resp{"charge1"}, got, t)
+		tst.Is(int32(1), charges.Load(), t)
+	})
+
+	t.Run("DifferentRequest", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+		ctx := srpc.WithIdempotencyKey(ctx, "different")
+		tst.Do(ep.Remote(conn)(ctx, Req{"charge"}))(t)
+		_, err := ep.Remote(conn)(ctx, Req{"refund"})
+		werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+		tst.Is(http.StatusUnprocessableEntity, werr.Code, t)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+		ctx := srpc.WithIdempotencyKey(ctx, "large")
+		tst.Do(ep.Remote(conn)(ctx, Req{"large"}))(t)
+		_, err := ep.Remote(conn)(ctx, Req{"large"})
+		tst.Is(true, errors.Is(err, srpc.ErrConflict), t)
+	})
+}
+
+func TestIdempotencyReplayHeaders(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/login")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		srpc.ResponseHeader(ctx).Set("Set-Cookie", "session=secret")
+		srpc.ResponseHeader(ctx).Set("X-Account", "42")
+		return Resp{strings.Repeat(req.B, 100)}, nil
+	}, srpc.WithIdempotency(srpc.NewMemoryIdempotencyStore(time.Hour, 100)),
+		srpc.WithResponseCompression(srpc.GzipEncoding))
+
+	call := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/login", strings.NewReader(`{"B":"x"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(srpc.IdempotencyKeyHeader, "key")
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+	first := call("gzip")
+	tst.Is("gzip", first.Header().Get("Content-Encoding"), t)
+	tst.Is("session=secret", first.Header().Get("Set-Cookie"), t)
+
+	replay := call("")
+	tst.Is("true", replay.Header().Get(srpc.ReplayedHeader), t)
+	tst.Is("", replay.Header().Get("Content-Encoding"), t)
+	tst.Is("", replay.Header().Get("Set-Cookie"), t)
+	tst.Is("42", replay.Header().Get("X-Account"), t)
+	tst.Is("Accept-Encoding", replay.Header().Get("Vary"), t)
+	tst.Is(`{"A":"`+strings.Repeat("x", 100)+`"}`, strings.TrimSpace(replay.Body.String()), t)
+
+	gzipped := call("gzip")
+	tst.Is("gzip", gzipped.Header().Get("Content-Encoding"), t)
+	tst.Is(true, gzipped.Body.Len() < replay.Body.Len(), t)
+}
+
+func TestMemoryIdempotencyStoreFull(t *testing.T) {
+	ctx := tst.Go(t)
+	store := srpc.NewMemoryIdempotencyStore(time.Hour, 1)
+	_, _ = tst.Do2(store.Reserve(ctx, "a"))(t)
+	_, _, err := store.Reserve(ctx, "b")
+	tst.Is(true, errors.Is(err, srpc.ErrServiceUnavailable), t)
+
+	// Released keys free their entry.
+	tst.No(store.Release(ctx, "a"), t)
+	_, _ = tst.Do2(store.Reserve(ctx, "b"))(t)
+}
@@ -0,0 +1,146 @@
+package srpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// inMemoryOrigin is the origin used by transports created with [NewInMemoryTransport].
+const inMemoryOrigin = "http://srpc.in-memory"
+
+// NewInMemoryTransport creates a Transport that serves calls by invoking h directly,
+// without going through the network.
+//
+// Requests and responses are still fully encoded, decoded and validated, so this is
+// a faster alternative to [net/http/httptest.Server] for tests.
+// Closing a response body waits for the handler to return.
+func NewInMemoryTransport(h http.Handler, opts ...TransportOption) (*Transport, error) {
+	return NewTransport(inMemoryOrigin, &http.Client{Transport: handlerRoundTripper{h}}, nil, opts...)
+}
+
+// handlerRoundTripper is a [http.RoundTripper] that serves requests with a [http.Handler].
+type handlerRoundTripper struct {
+	h http.Handler
+}
+
+func (rt handlerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	sreq := req.Clone(ctx)
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.RemoteAddr = "127.0.0.1:0"
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	w := &pipeResponseWriter{
+		header: http.Header{},
+		pw:     pw,
+		ready:  make(chan struct{}),
+		resp: &http.Response{
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			ContentLength: -1,
+			Body:          &cancelReadCloser{ReadCloser: pr, cancel: cancel, done: done},
+			Trailer:       http.Header{},
+			Request:       req,
+		},
+	}
+	go func() {
+		var err error
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("in-memory handler panicked: %v", r)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.WriteHeader(http.StatusOK)
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			w.setTrailers()
+			_ = pw.CloseWithError(err)
+		}()
+		rt.h.ServeHTTP(w, sreq)
+	}()
+
+	select {
+	case <-w.ready:
+		return w.resp, nil
+	case <-ctx.Done():
+		_ = pr.CloseWithError(ctx.Err())
+		cancel()
+		return nil, ctx.Err()
+	}
+}
+
+// pipeResponseWriter is a [http.ResponseWriter] that streams the body through a pipe.
+type pipeResponseWriter struct {
+	header http.Header
+	pw     *io.PipeWriter
+	once   sync.Once
+	ready  chan struct{}
+	resp   *http.Response
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		// Informational responses are not delivered.
+		return
+	}
+	w.once.Do(func() {
+		w.resp.StatusCode = code
+		w.resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		w.resp.Header = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *pipeResponseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pw.Write(buf)
+}
+
+// setTrailers copies the trailers set by the handler to the response, it must be called after the handler returns.
+func (w *pipeResponseWriter) setTrailers() {
+	for k, v := range w.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			w.resp.Trailer[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	for _, names := range w.resp.Header.Values("Trailer") {
+		for name := range strings.SplitSeq(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if v, ok := w.header[name]; ok {
+				w.resp.Trailer[name] = v
+			}
+		}
+	}
+}
+
+func (w *pipeResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// cancelReadCloser cancels the handler context when the client closes the response body,
+// and waits for the handler to return.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	done   <-chan struct{}
+}
+
+func (c *cancelReadCloser) Close() error {
+	c.cancel()
+	err := c.ReadCloser.Close()
+	<-c.done
+	return err
+}
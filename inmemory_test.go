@@ -0,0 +1,56 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestInMemoryTransport(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "fail" {
+			return Resp{}, &srpc.WireError{Msg: "failed", Code: http.StatusConflict}
+		}
+		return Resp{"mem" + req.B}, nil
+	})
+	seq := srpc.NewEndpointSeq[SeqResp, Req]("/mem/seq")
+	seq.Register(mux, func(ctx context.Context, req Req) (iter.Seq2[SeqResp, error], error) {
+		return func(yield func(SeqResp, error) bool) {
+			for i := range 3 {
+				if !yield(SeqResp{i}, nil) {
+					return
+				}
+			}
+		}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	t.Run("OK", func(t *testing.T) {
+		got := tst.Do(Ep.Remote(conn)(ctx, Req{"req"}))(t)
+		tst.Is(Resp{"memreq"}, got, t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := Ep.Remote(conn)(ctx, Req{"fail"})
+		werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+		tst.Is(http.StatusConflict, werr.Code, t)
+		tst.Is("failed", werr.Msg, t)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		got := tst.Do(seq.Remote(conn)(ctx, Req{}))(t)
+		var vals []int
+		for v, err := range got {
+			tst.No(err, t)
+			vals = append(vals, v.Data)
+		}
+		tst.Is([]int{0, 1, 2}, vals, t)
+	})
+}
@@ -0,0 +1,102 @@
+package srpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithKeepAlive makes Server-Sent-Events endpoints, like the ones of [NewEndpointSeq], send a comment
+// when no event was sent for interval, so that proxies don't close idle connections.
+//
+// Comments are ignored by clients, including browsers' EventSource.
+func WithKeepAlive(interval time.Duration) ServerOption {
+	return func(c *serverConfig) { c.keepAlive = interval }
+}
+
+// withKeepAlive returns a context that carries the keep-alive interval for the response codec.
+func withKeepAlive(ctx context.Context, interval time.Duration) context.Context {
+	if interval <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, keepAliveKey{}, interval)
+}
+
+// keepAliveFromContext returns the keep-alive interval set with [WithKeepAlive], or zero.
+func keepAliveFromContext(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(keepAliveKey{}).(time.Duration)
+	return d
+}
+
+// pinger writes a comment to an event stream when it has been idle for a while.
+//
+// Events must be written between lock and unlock, so that comments are not interleaved with them.
+type pinger struct {
+	mu       sync.Mutex
+	timer    *time.Timer
+	interval time.Duration
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// startPinger starts pinging w every interval until stop is called or ctx is done.
+// It returns nil if interval is not positive.
+func startPinger(ctx context.Context, w writeFlusher, interval time.Duration) *pinger {
+	if interval <= 0 {
+		return nil
+	}
+	p := &pinger{
+		timer:    time.NewTimer(interval),
+		interval: interval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go func() {
+		defer close(p.stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.done:
+				return
+			case <-p.timer.C:
+			}
+			p.mu.Lock()
+			_, err := io.WriteString(w, ": ping\n\n")
+			if err == nil {
+				w.Flush()
+			}
+			p.mu.Unlock()
+			if err != nil {
+				return
+			}
+			p.timer.Reset(interval)
+		}
+	}()
+	return p
+}
+
+// lock waits for pending comments to be written, it is a no-op on a nil pinger.
+func (p *pinger) lock() {
+	if p != nil {
+		p.mu.Lock()
+	}
+}
+
+// unlock postpones the next comment to interval from now, it is a no-op on a nil pinger.
+func (p *pinger) unlock() {
+	if p != nil {
+		p.timer.Reset(p.interval)
+		p.mu.Unlock()
+	}
+}
+
+// stop stops pinging and waits for the last comment to be written, it is a no-op on a nil pinger.
+func (p *pinger) stop() {
+	if p != nil {
+		close(p.done)
+		p.timer.Stop()
+		<-p.stopped
+	}
+}
@@ -0,0 +1,138 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithConcurrencyLimit makes endpoints serve at most n requests at a time.
+//
+// Requests that exceed the limit wait up to queueTimeout for a slot, and are then rejected
+// with 503 Service Unavailable. A queueTimeout of zero rejects them right away.
+//
+// Every endpoint has its own limit, even if the option is passed to [NewServer].
+func WithConcurrencyLimit(n int, queueTimeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.maxConcurrent = n
+		c.queueTimeout = queueTimeout
+	}
+}
+
+// semaphore limits the number of requests an endpoint serves concurrently.
+type semaphore struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newSemaphore returns the semaphore for an endpoint configured with cfg, or nil if it has no limit.
+func newSemaphore(cfg serverConfig) *semaphore {
+	if cfg.maxConcurrent <= 0 {
+		return nil
+	}
+	return &semaphore{slots: make(chan struct{}, cfg.maxConcurrent), timeout: cfg.queueTimeout}
+}
+
+// acquire waits for a slot and reports whether it got one. Slots must be given back with release.
+//
+// It is a no-op on a nil semaphore.
+func (s *semaphore) acquire(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if s.timeout <= 0 {
+		return false
+	}
+	t := time.NewTimer(s.timeout)
+	defer t.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release gives back a slot obtained with acquire.
+func (s *semaphore) release() {
+	if s != nil {
+		<-s.slots
+	}
+}
+
+// ErrResponseTooLarge is returned by calls whose response body exceeds the limit set with [WithMaxResponseBytes].
+var ErrResponseTooLarge = errors.New("response too large")
+
+// WithMaxResponseBytes makes calls fail with [ErrResponseTooLarge] when the body of the response,
+// after decompression, is larger than n bytes, so that misbehaving servers can't exhaust the memory of clients.
+//
+// The limit applies to streamed responses as a whole. Error responses larger than n bytes are truncated:
+// calls fail with their [*WireError], which also matches ErrResponseTooLarge.
+func WithMaxResponseBytes(n int64) TransportOption {
+	return func(t *Transport) { t.maxResponseBytes = n }
+}
+
+// limitedBody is a response body that fails once more than left bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// Read one byte more than allowed to tell bodies that are exactly at the limit from larger ones.
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), ErrResponseTooLarge
+	}
+	return n, err
+}
+
+// WithMaxRequestBytes makes endpoints reject requests whose body is larger than n bytes with
+// 413 Request Entity Too Large.
+//
+// Requests that declare a larger Content-Length are rejected before their body is read, which
+// saves clients that use [WithExpectContinue] from sending it. The limit applies to the body as sent,
+// before decompression.
+func WithMaxRequestBytes(n int64) ServerOption {
+	return func(c *serverConfig) { c.maxRequestBytes = n }
+}
+
+// maxBufferedBytes limits the size of the request bodies buffered by [WithVerifier] and [WithIdempotency]
+// if [WithMaxRequestBytes] is not set.
+const maxBufferedBytes = 10 << 20
+
+// bufferRequest reads the whole body of r, within the limits of cfg, and replaces it with an in-memory copy.
+//
+// If the body can't be read it writes the error response to w and returns false.
+func bufferRequest(cfg serverConfig, w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	limit := cfg.maxRequestBytes
+	if limit <= 0 {
+		limit = maxBufferedBytes
+	}
+	body, err := bufferBody(r, limit)
+	if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		http.Error(w, "Request too large.", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Unable to read request.", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,86 @@
+package srpc
+
+import (
+	"context"
+	"time"
+)
+
+// ClientEvent describes a call issued by a [Transport].
+type ClientEvent struct {
+	// Method and Path identify the called endpoint. Path is the endpoint pattern.
+	Method, Path string
+	// Attempt is the number of the current attempt, starting from 1.
+	Attempt int
+	// Status is the HTTP status of the response, or 0 if none was received.
+	Status int
+	// Duration is the time spent on the whole call, including retries. It is only set by CallEnd.
+	Duration time.Duration
+	// Err is the error that caused a retry or failed the call, if any.
+	Err error
+}
+
+// ClientMetrics observes the calls issued by a [Transport].
+//
+// Implementations must be safe for concurrent use.
+type ClientMetrics interface {
+	// CallStart is called before a call is issued.
+	CallStart(ctx context.Context, ev ClientEvent)
+	// CallRetry is called before a failed attempt is retried.
+	CallRetry(ctx context.Context, ev ClientEvent)
+	// CallEnd is called when a call returns.
+	//
+	// For streaming responses this happens before the stream is consumed.
+	CallEnd(ctx context.Context, ev ClientEvent)
+}
+
+// WithClientMetrics makes the [Transport] report its calls to m.
+func WithClientMetrics(m ClientMetrics) TransportOption {
+	return func(t *Transport) {
+		t.metrics = m
+	}
+}
+
+type nopClientMetrics struct{}
+
+func (nopClientMetrics) CallStart(context.Context, ClientEvent) {}
+func (nopClientMetrics) CallRetry(context.Context, ClientEvent) {}
+func (nopClientMetrics) CallEnd(context.Context, ClientEvent)   {}
+
+// ServerEvent describes a request served by an endpoint.
+type ServerEvent struct {
+	// Method and Path identify the endpoint. Path is the endpoint pattern.
+	Method, Path string
+	// Status is the HTTP status sent to the client.
+	Status int
+	// DecodeDuration is the time spent decoding the request.
+	DecodeDuration time.Duration
+	// EncodeDuration is the time spent encoding the response, excluding the time to send it.
+	EncodeDuration time.Duration
+	// Duration is the time spent serving the whole request.
+	Duration time.Duration
+	// ValidationFailed reports whether the request was rejected by [Validable].
+	ValidationFailed bool
+	// BytesIn is the size of the encoded request read by the request codec.
+	BytesIn int64
+	// BytesOut is the size of the encoded response, before compression.
+	BytesOut int64
+}
+
+// ServerMetrics observes the requests served by endpoints.
+//
+// Implementations must be safe for concurrent use.
+type ServerMetrics interface {
+	// RequestServed is called once a request has been served, whether it succeeded or not.
+	RequestServed(ctx context.Context, ev ServerEvent)
+}
+
+// WithServerMetrics makes endpoints report the requests they serve to m.
+func WithServerMetrics(m ServerMetrics) ServerOption {
+	return func(c *serverConfig) {
+		c.metrics = m
+	}
+}
+
+type nopServerMetrics struct{}
+
+func (nopServerMetrics) RequestServed(context.Context, ServerEvent) {}
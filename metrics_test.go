@@ -0,0 +1,110 @@
+package srpc_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type recordedEvent struct {
+	Kind    string
+	Method  string
+	Path    string
+	Attempt int
+	Status  int
+	Failed  bool
+}
+
+type clientRecorder struct {
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+func (r *clientRecorder) record(kind string, ev srpc.ClientEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, recordedEvent{kind, ev.Method, ev.Path, ev.Attempt, ev.Status, ev.Err != nil})
+}
+
+func (r *clientRecorder) CallStart(_ context.Context, ev srpc.ClientEvent) { r.record("start", ev) }
+func (r *clientRecorder) CallRetry(_ context.Context, ev srpc.ClientEvent) { r.record("retry", ev) }
+func (r *clientRecorder) CallEnd(_ context.Context, ev srpc.ClientEvent)   { r.record("end", ev) }
+
+func TestClientMetrics(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPut, "/metrics")
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if calls.Add(1) == 1 {
+			return Resp{}, srpc.NewWireError(http.StatusServiceUnavailable, "later")
+		}
+		if req.B == "fail" {
+			return Resp{}, srpc.NotFound("nope")
+		}
+		return Resp{}, nil
+	})
+	var rec clientRecorder
+	conn := tst.Do(srpc.NewInMemoryTransport(mux,
+		srpc.WithClientMetrics(&rec),
+		srpc.WithRetry(srpc.RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }}),
+	))(t)
+	c := ep.Remote(conn)
+	_ = tst.Do(c(ctx, Req{}))(t)
+	_, err := c(ctx, Req{"fail"})
+	tst.Err("nope", err, t)
+
+	const path = "/metrics"
+	tst.Is([]recordedEvent{
+		{"start", http.MethodPut, path, 0, 0, false},
+		{"retry", http.MethodPut, path, 1, http.StatusServiceUnavailable, false},
+		{"end", http.MethodPut, path, 2, http.StatusOK, false},
+		{"start", http.MethodPut, path, 0, 0, false},
+		{"end", http.MethodPut, path, 1, http.StatusNotFound, true},
+	}, rec.events, t)
+}
+
+type serverRecorder struct {
+	mu     sync.Mutex
+	events []srpc.ServerEvent
+}
+
+func (r *serverRecorder) RequestServed(_ context.Context, ev srpc.ServerEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev.Duration, ev.DecodeDuration, ev.EncodeDuration = 0, 0, 0
+	r.events = append(r.events, ev)
+}
+
+func TestServerMetrics(t *testing.T) {
+	ctx := tst.Go(t)
+	var rec serverRecorder
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithServerMetrics(&rec))
+	ep := srpc.NewEndpointJSON[Resp, ValReq](http.MethodPost, "/served")
+	ep.Register(srv, func(ctx context.Context, req ValReq) (Resp, error) {
+		if req.B == "fail" {
+			return Resp{}, srpc.NotFound("nope")
+		}
+		return Resp{}, nil
+	})
+	c := ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))
+	_ = tst.Do(c(ctx, ValReq{"ok"}))(t)
+	_, err := c(ctx, ValReq{"fail"})
+	tst.Err("nope", err, t)
+	_, err = c(ctx, ValReq{""})
+	tst.Err("empty", err, t)
+
+	const path = "/served"
+	tst.Is([]srpc.ServerEvent{
+		{Method: http.MethodPost, Path: path, Status: http.StatusOK, BytesIn: int64(len(`{"B":"ok"}`)), BytesOut: int64(len(`{"A":""}`))},
+		{Method: http.MethodPost, Path: path, Status: http.StatusNotFound, BytesIn: int64(len(`{"B":"fail"}`))},
+		{Method: http.MethodPost, Path: path, Status: http.StatusBadRequest, ValidationFailed: true, BytesIn: int64(len(`{"B":""}`))},
+	}, rec.events, t)
+}
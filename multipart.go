@@ -0,0 +1,280 @@
+package srpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// FilePart is a file in a multipart/form-data message, see [NewCodecMultipart].
+type FilePart struct {
+	// Filename is the name of the file as reported by the sender.
+	Filename string
+	// ContentType is the Content-Type of the part.
+	ContentType string
+	// Size is the size of Content in bytes. It is only set on decoded parts.
+	Size int64
+	// Content is the file content.
+	Content io.Reader
+}
+
+type multipartKind int
+
+const (
+	multipartValue multipartKind = iota
+	multipartValues
+	multipartFile
+	multipartFiles
+)
+
+var (
+	stringType    = reflect.TypeFor[string]()
+	stringsType   = reflect.TypeFor[[]string]()
+	filePartType  = reflect.TypeFor[*FilePart]()
+	filePartsType = reflect.TypeFor[[]*FilePart]()
+)
+
+type multipartField struct {
+	index int
+	name  string
+	kind  multipartKind
+}
+
+// multipartFields returns the form fields of the struct type t.
+//
+// It panics if t is not a struct or if a tagged field has an unsupported type.
+func multipartFields(t reflect.Type) map[string]multipartField {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("multipart codec requires a struct type, %v provided", t))
+	}
+	fields := map[string]multipartField{}
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name := sf.Tag.Get("form")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+		f := multipartField{index: i, name: name}
+		switch sf.Type {
+		case stringType:
+			f.kind = multipartValue
+		case stringsType:
+			f.kind = multipartValues
+		case filePartType:
+			f.kind = multipartFile
+		case filePartsType:
+			f.kind = multipartFiles
+		default:
+			panic(fmt.Sprintf("unsupported type %v for multipart field %q", sf.Type, name))
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// contentTypeReader is a stream that carries its own Content-Type.
+type contentTypeReader struct {
+	io.ReadCloser
+	contentType string
+}
+
+func (r contentTypeReader) ContentType() string { return r.contentType }
+
+// NewCodecMultipart creates a Codec for multipart/form-data messages, as sent by browsers to upload files.
+//
+// T must be a struct: its fields tagged with `form:"name"` are mapped to the form fields with the same name.
+// Fields of type string or []string hold values, fields of type *FilePart or []*FilePart hold files.
+//
+// When decoding, up to maxMemory bytes are kept in memory and larger files are spilled to temporary files,
+// which are removed once the response has been sent. Files larger than maxFileSize are rejected.
+//
+// This codec is meant to be used for requests.
+func NewCodecMultipart[T any](maxMemory, maxFileSize int64) Codec[T] {
+	fields := multipartFields(reflect.TypeFor[T]())
+	return Codec[T]{
+		ContentType: "multipart/form-data",
+		Co: func(_ context.Context, t T) (io.Reader, error) {
+			pr, pw := io.Pipe()
+			mw := multipart.NewWriter(pw)
+			go func() {
+				_ = pw.CloseWithError(writeMultipart(mw, reflect.ValueOf(t), fields))
+			}()
+			return contentTypeReader{ReadCloser: pr, contentType: mw.FormDataContentType()}, nil
+		},
+		Dec: func(ctx context.Context, r io.Reader) (t T, err error) {
+			_, params, err := mime.ParseMediaType(ContentTypeFromContext(ctx))
+			if err != nil {
+				return t, fmt.Errorf("parsing Content-Type: %w", err)
+			}
+			boundary := params["boundary"]
+			if boundary == "" {
+				return t, errors.New("missing multipart boundary")
+			}
+			d := multipartDecoder{ctx: ctx, budget: maxMemory, maxFileSize: maxFileSize}
+			return t, d.decode(multipart.NewReader(r, boundary), reflect.ValueOf(&t).Elem(), fields)
+		},
+	}
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func writeMultipart(mw *multipart.Writer, v reflect.Value, fields map[string]multipartField) error {
+	writeFile := func(name string, fp *FilePart) error {
+		if fp == nil {
+			return nil
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(name), quoteEscaper.Replace(fp.Filename)))
+		ct := fp.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		h.Set("Content-Type", ct)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if fp.Content == nil {
+			return nil
+		}
+		_, err = io.Copy(w, fp.Content)
+		return err
+	}
+
+	for name, f := range fields {
+		fv := v.Field(f.index)
+		var err error
+		switch f.kind {
+		case multipartValue:
+			err = mw.WriteField(name, fv.String())
+		case multipartValues:
+			for _, s := range fv.Interface().([]string) { //nolint: forcetypeassert // checked by multipartFields.
+				if err = mw.WriteField(name, s); err != nil {
+					break
+				}
+			}
+		case multipartFile:
+			err = writeFile(name, fv.Interface().(*FilePart)) //nolint: forcetypeassert // checked by multipartFields.
+		case multipartFiles:
+			for _, fp := range fv.Interface().([]*FilePart) { //nolint: forcetypeassert // checked by multipartFields.
+				if err = writeFile(name, fp); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("writing multipart field %q: %w", name, err)
+		}
+	}
+	return mw.Close()
+}
+
+type multipartDecoder struct {
+	ctx         context.Context //nolint: containedctx // only lives for the duration of Dec.
+	budget      int64
+	maxFileSize int64
+}
+
+func (d *multipartDecoder) decode(mr *multipart.Reader, v reflect.Value, fields map[string]multipartField) error {
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f, ok := fields[part.FormName()]
+		if !ok {
+			continue
+		}
+		fv := v.Field(f.index)
+		switch f.kind {
+		case multipartValue, multipartValues:
+			buf, err := io.ReadAll(io.LimitReader(part, d.budget+1))
+			if err != nil {
+				return err
+			}
+			if int64(len(buf)) > d.budget {
+				return fmt.Errorf("multipart field %q exceeds the memory limit", f.name)
+			}
+			d.budget -= int64(len(buf))
+			if f.kind == multipartValue {
+				fv.SetString(string(buf))
+			} else {
+				fv.Set(reflect.Append(fv, reflect.ValueOf(string(buf))))
+			}
+		case multipartFile, multipartFiles:
+			fp, err := d.file(part)
+			if err != nil {
+				return fmt.Errorf("multipart file %q: %w", f.name, err)
+			}
+			if f.kind == multipartFile {
+				fv.Set(reflect.ValueOf(fp))
+			} else {
+				fv.Set(reflect.Append(fv, reflect.ValueOf(fp)))
+			}
+		}
+	}
+}
+
+// file reads a file part, keeping it in memory if it fits the remaining budget
+// and spilling it to a temporary file otherwise.
+func (d *multipartDecoder) file(part *multipart.Part) (*FilePart, error) {
+	fp := &FilePart{
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+	}
+	lr := io.LimitReader(part, d.maxFileSize+1)
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, lr, d.budget+1)
+	if errors.Is(err, io.EOF) {
+		if n > d.maxFileSize {
+			return nil, fmt.Errorf("file exceeds the maximum size of %d bytes", d.maxFileSize)
+		}
+		d.budget -= n
+		fp.Size = n
+		fp.Content = bytes.NewReader(buf.Bytes())
+		return fp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "srpc-multipart-*")
+	if err != nil {
+		return nil, err
+	}
+	if !onCleanup(d.ctx, func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}) {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, errors.New("spilling to disk is only supported when serving requests")
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		return nil, err
+	}
+	rest, err := io.Copy(f, lr)
+	if err != nil {
+		return nil, err
+	}
+	fp.Size = n + rest
+	if fp.Size > d.maxFileSize {
+		return nil, fmt.Errorf("file exceeds the maximum size of %d bytes", d.maxFileSize)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	fp.Content = f
+	return fp, nil
+}
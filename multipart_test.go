@@ -0,0 +1,72 @@
+package srpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type Upload struct {
+	Title string           `form:"title"`
+	Tags  []string         `form:"tag"`
+	File  *srpc.FilePart   `form:"file"`
+	Extra []*srpc.FilePart `form:"extra"`
+}
+
+type UploadResp struct {
+	Title    string
+	Tags     []string
+	Contents []string
+	Names    []string
+}
+
+func TestMultipart(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpoint(http.MethodPost, "/upload", srpc.NewCodecJSON[UploadResp](), srpc.NewCodecMultipart[Upload](16, 32))
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Upload) (UploadResp, error) {
+		resp := UploadResp{Title: req.Title, Tags: req.Tags}
+		for _, fp := range append([]*srpc.FilePart{req.File}, req.Extra...) {
+			buf, err := io.ReadAll(fp.Content)
+			if err != nil {
+				return resp, err
+			}
+			resp.Contents = append(resp.Contents, string(buf))
+			resp.Names = append(resp.Names, fp.Filename+":"+fp.ContentType)
+		}
+		return resp, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := ep.RemoteWithOrigin(srv.URL)
+
+	t.Run("OK", func(t *testing.T) {
+		got := tst.Do(c(ctx, Upload{
+			Title: "title",
+			Tags:  []string{"a", "b"},
+			File:  &srpc.FilePart{Filename: "small.txt", ContentType: "text/plain", Content: strings.NewReader("small")},
+			Extra: []*srpc.FilePart{
+				{Filename: "big.bin", Content: strings.NewReader("this does not fit in memory")},
+			},
+		}))(t)
+		tst.Is(UploadResp{
+			Title:    "title",
+			Tags:     []string{"a", "b"},
+			Contents: []string{"small", "this does not fit in memory"},
+			Names:    []string{"small.txt:text/plain", "big.bin:application/octet-stream"},
+		}, got, t)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		_, err := c(ctx, Upload{
+			File: &srpc.FilePart{Filename: "huge.bin", Content: strings.NewReader(strings.Repeat("x", 64))},
+		})
+		tst.Is(true, srpc.IsBadRequest(err), t)
+	})
+}
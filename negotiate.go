@@ -0,0 +1,63 @@
+package srpc
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// weighted is an element of a header list with an optional quality value, like Accept-Language.
+type weighted struct {
+	value string
+	q     float64
+}
+
+// parseWeighted parses a comma-separated list of values with optional quality values,
+// as used by Accept-Language and Accept-Encoding.
+//
+// The returned values are sorted by decreasing quality, keeping the header order for ties.
+// Values with an invalid quality have a quality of zero, which means they are not acceptable.
+func parseWeighted(header string) []weighted {
+	var ws []weighted
+	for item := range strings.SplitSeq(header, ",") {
+		value, params, _ := strings.Cut(item, ";")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for p := range strings.SplitSeq(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if !strings.EqualFold(k, "q") {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				f = 0
+			}
+			q = f
+		}
+		ws = append(ws, weighted{value: value, q: q})
+	}
+	slices.SortStableFunc(ws, func(a, b weighted) int { return cmp.Compare(b.q, a.q) })
+	return ws
+}
+
+// formatAcceptLanguage formats langs, ordered by preference, as an Accept-Language header value.
+//
+// Quality values decrease by 0.1 for each language, down to a minimum of 0.1.
+func formatAcceptLanguage(langs []string) string {
+	const tenths = 10
+	var b strings.Builder
+	for i, l := range langs {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(l)
+		if i > 0 {
+			b.WriteString(";q=0." + strconv.Itoa(max(tenths-i, 1)))
+		}
+	}
+	return b.String()
+}
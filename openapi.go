@@ -0,0 +1,283 @@
+package srpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OpenAPI 3.0 document, only the subset that srpc generates.
+type (
+	oaDocument struct {
+		OpenAPI    string                      `json:"openapi"`
+		Info       oaInfo                      `json:"info"`
+		Paths      map[string]map[string]*oaOp `json:"paths"`
+		Components *oaComponents               `json:"components,omitempty"`
+	}
+	oaInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+	oaComponents struct {
+		Schemas map[string]*oaSchema `json:"schemas"`
+	}
+	oaOp struct {
+		Parameters  []oaParam             `json:"parameters,omitempty"`
+		RequestBody *oaBody               `json:"requestBody,omitempty"`
+		Responses   map[string]oaResponse `json:"responses"`
+	}
+	oaParam struct {
+		Name     string                 `json:"name"`
+		In       string                 `json:"in"`
+		Required bool                   `json:"required,omitempty"`
+		Schema   *oaSchema              `json:"schema,omitempty"`
+		Content  map[string]oaMediaType `json:"content,omitempty"`
+	}
+	oaBody struct {
+		Required bool                   `json:"required"`
+		Content  map[string]oaMediaType `json:"content"`
+	}
+	oaResponse struct {
+		Description string                 `json:"description"`
+		Content     map[string]oaMediaType `json:"content,omitempty"`
+	}
+	oaMediaType struct {
+		Schema *oaSchema `json:"schema"`
+	}
+	oaSchema struct {
+		Ref                  string               `json:"$ref,omitempty"`
+		Type                 string               `json:"type,omitempty"`
+		Format               string               `json:"format,omitempty"`
+		Nullable             bool                 `json:"nullable,omitempty"`
+		Items                *oaSchema            `json:"items,omitempty"`
+		Properties           map[string]*oaSchema `json:"properties,omitempty"`
+		AdditionalProperties *oaSchema            `json:"additionalProperties,omitempty"`
+	}
+)
+
+// GenerateOpenAPI generates an OpenAPI 3.0 document, encoded as JSON, that describes endpoints.
+//
+// Schemas are derived from the request and response types following the [encoding/json] rules,
+// named struct types are described once in the components section. Messages with a wire format other
+// than JSON are described as binary strings. Every operation lists a plain text "default" response
+// for errors, as sent by [WireError].
+//
+// Endpoints can be obtained with [Server.Endpoints].
+func GenerateOpenAPI(title, version string, endpoints []EndpointInfo) ([]byte, error) {
+	g := &oaGenerator{schemas: map[string]*oaSchema{}, names: map[reflect.Type]string{}}
+	doc := oaDocument{
+		OpenAPI: "3.0.3",
+		Info:    oaInfo{Title: title, Version: version},
+		Paths:   map[string]map[string]*oaOp{},
+	}
+	for _, e := range endpoints {
+		path, params := oaPath(e.Path)
+		op := &oaOp{Parameters: params, Responses: map[string]oaResponse{
+			"default": {Description: "Error", Content: map[string]oaMediaType{
+				"text/plain": {Schema: &oaSchema{Type: "string"}},
+			}},
+		}}
+
+		hasRequest := e.Request != reflect.TypeFor[struct{}]()
+		switch m := e.Method; {
+		case !hasRequest:
+		case m == http.MethodPost || m == http.MethodPut || m == http.MethodPatch || m == http.MethodDelete:
+			op.RequestBody = &oaBody{Required: true, Content: map[string]oaMediaType{
+				mediaRange(e.RequestContentType): {Schema: g.messageSchema(e.Request, e.RequestContentType)},
+			}}
+		case e.rawQuery:
+			params, err := g.queryParams(e.Request)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", e.Method, e.Path, err)
+			}
+			op.Parameters = append(op.Parameters, params...)
+		default:
+			op.Parameters = append(op.Parameters, oaParam{Name: e.queryKey, In: "query", Required: true, Content: map[string]oaMediaType{
+				mediaRange(e.RequestContentType): {Schema: g.messageSchema(e.Request, e.RequestContentType)},
+			}})
+		}
+
+		if e.Response == reflect.TypeFor[struct{}]() {
+			op.Responses["204"] = oaResponse{Description: "No Content"}
+		} else {
+			op.Responses["200"] = oaResponse{Description: "OK", Content: map[string]oaMediaType{
+				mediaRange(e.ResponseContentType): {Schema: g.messageSchema(e.Response, e.ResponseContentType)},
+			}}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*oaOp{}
+		}
+		doc.Paths[path][strings.ToLower(e.Method)] = op
+	}
+	if len(g.schemas) > 0 {
+		doc.Components = &oaComponents{Schemas: g.schemas}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// mediaRange returns the media range of messages with the given Content-Type, which matches any type if it is empty.
+func mediaRange(contentType string) string {
+	if contentType == "" {
+		return "*/*"
+	}
+	return contentType
+}
+
+// oaPath converts a [http.ServeMux] path pattern to an OpenAPI path and its parameters.
+//
+// "{name...}" wildcards are described as single parameters, as OpenAPI has no equivalent.
+func oaPath(pattern string) (string, []oaParam) {
+	var params []oaParam
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(seg[1:len(seg)-1], "...")
+		if name == "$" {
+			segs[i] = ""
+			continue
+		}
+		segs[i] = "{" + name + "}"
+		params = append(params, oaParam{Name: name, In: "path", Required: true, Schema: &oaSchema{Type: "string"}})
+	}
+	return strings.Join(segs, "/"), params
+}
+
+// oaGenerator derives schemas from Go types.
+type oaGenerator struct {
+	schemas map[string]*oaSchema
+	names   map[reflect.Type]string
+}
+
+// messageSchema returns the schema for messages of type t sent with the given content type.
+func (g *oaGenerator) messageSchema(t reflect.Type, contentType string) *oaSchema {
+	if contentType != "application/json" {
+		return &oaSchema{Type: "string", Format: "binary"}
+	}
+	return g.schema(t)
+}
+
+// queryParams describes the fields of t mapped to query parameters by the query codec.
+func (g *oaGenerator) queryParams(t reflect.Type) (params []oaParam, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	for _, f := range queryFields(t) {
+		params = append(params, oaParam{Name: f.name, In: "query", Schema: g.schema(t.Field(f.index).Type)})
+	}
+	return params, nil
+}
+
+var (
+	timeType         = reflect.TypeFor[time.Time]()
+	rawMessageType   = reflect.TypeFor[json.RawMessage]()
+	readCloserType   = reflect.TypeFor[io.ReadCloser]()
+	invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// schema returns the schema of the JSON encoding of t.
+func (g *oaGenerator) schema(t reflect.Type) *oaSchema {
+	switch t {
+	case timeType:
+		return &oaSchema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &oaSchema{}
+	case readCloserType:
+		return &oaSchema{Type: "string", Format: "binary"}
+	}
+	switch t.Kind() { //nolint: exhaustive // other kinds are described by an empty schema.
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &oaSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &oaSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &oaSchema{Type: "number"}
+	case reflect.String:
+		return &oaSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &oaSchema{Type: "string", Format: "byte"}
+		}
+		return &oaSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &oaSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.uniqueName(t)
+			g.names[t] = name
+			g.schemas[name] = &oaSchema{}
+			*g.schemas[name] = *g.structSchema(t)
+		}
+		return &oaSchema{Ref: "#/components/schemas/" + name}
+	default:
+		return &oaSchema{}
+	}
+}
+
+// uniqueName returns a component name for the named type t.
+func (g *oaGenerator) uniqueName(t reflect.Type) string {
+	base := invalidNameChars.ReplaceAllString(t.Name(), "_")
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := g.schemas[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// structSchema describes the JSON object a struct is encoded as.
+func (g *oaGenerator) structSchema(t reflect.Type) *oaSchema {
+	s := &oaSchema{Type: "object", Properties: map[string]*oaSchema{}}
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range g.structSchema(ft).Properties {
+					if _, ok := s.Properties[k]; !ok {
+						s.Properties[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		s.Properties[name] = g.schema(sf.Type)
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package srpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type Tree struct {
+	Name     string  `json:"name"`
+	Children []*Tree `json:"children,omitempty"`
+	Secret   string  `json:"-"`
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	tst.Go(t)
+	srv := srpc.NewServer(http.NewServeMux())
+	put := srpc.NewEndpointJSON[Tree, Tree](http.MethodPut, "/trees/{id}")
+	put.Register(srv, func(ctx context.Context, req Tree) (Tree, error) { return req, nil })
+	search := srpc.NewEndpointQuery[Resp, Search]("/search")
+	search.Register(srv, func(ctx context.Context, req Search) (Resp, error) { return Resp{}, nil })
+	wep := srpc.NewEndpointJSON[struct{}, Req](http.MethodPost, "/w")
+	w := (*srpc.EndpointW[Req])(&wep)
+	w.Register(srv, func(ctx context.Context, req Req) error { return nil })
+	rep := srpc.NewEndpointJSON[Resp, struct{}](http.MethodGet, "/r")
+	r := (*srpc.EndpointR[Resp])(&rep)
+	r.Register(srv, func(ctx context.Context) (Resp, error) { return Resp{}, nil })
+
+	buf := tst.Do(srpc.GenerateOpenAPI("Test", "1.0.0", srv.Endpoints()))(t)
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string
+				In   string
+			}
+			RequestBody *struct {
+				Content map[string]struct {
+					Schema struct {
+						Ref string `json:"$ref"`
+					}
+				}
+			}
+			Responses map[string]struct {
+				Content map[string]any
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type  string
+					Items struct {
+						Ref string `json:"$ref"`
+					}
+				}
+			}
+		}
+	}
+	tst.No(json.Unmarshal(buf, &doc), t)
+
+	op := doc.Paths["/trees/{id}"]["put"]
+	tst.Is("id", op.Parameters[0].Name, t)
+	tst.Is("path", op.Parameters[0].In, t)
+	tst.Is("#/components/schemas/Tree", op.RequestBody.Content["application/json"].Schema.Ref, t)
+	tree := doc.Components.Schemas["Tree"]
+	tst.Is(2, len(tree.Properties), t)
+	tst.Is("array", tree.Properties["children"].Type, t)
+	tst.Is("#/components/schemas/Tree", tree.Properties["children"].Items.Ref, t)
+
+	op = doc.Paths["/search"]["get"]
+	tst.Is(4, len(op.Parameters), t)
+	tst.Is("q", op.Parameters[0].Name, t)
+	tst.Is("limit", op.Parameters[1].Name, t)
+
+	_, ok := doc.Paths["/w"]["post"].Responses["204"]
+	tst.Is(true, ok, t)
+	tst.Is(true, doc.Paths["/w"]["post"].RequestBody != nil, t)
+	tst.Is(true, doc.Paths["/r"]["get"].RequestBody == nil, t)
+	tst.Is(0, len(doc.Paths["/r"]["get"].Parameters), t)
+	tst.Is(1, len(doc.Paths["/r"]["get"].Responses["200"].Content), t)
+}
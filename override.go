@@ -0,0 +1,105 @@
+package srpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// MethodOverrideHeader is the header that carries the real method of requests sent as POST
+// by transports created with [WithClientMethodOverride], and read by servers created with [WithMethodOverride].
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridable reports whether requests with the given method can be tunneled through POST.
+func overridable(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithMethodOverride makes a [Server] accept POST requests carrying a [MethodOverrideHeader]
+// as if they were sent with the method in the header.
+//
+// Only PUT, PATCH and DELETE can be overridden. It must be passed to [NewServer], it has no effect
+// on single endpoints.
+func WithMethodOverride() ServerOption {
+	return func(c *serverConfig) { c.methodOverride = true }
+}
+
+// overrideRoute holds the handlers of a path that can be reached through method override.
+type overrideRoute struct {
+	post     func(http.ResponseWriter, *http.Request)
+	handlers map[string]func(http.ResponseWriter, *http.Request)
+}
+
+// handleOverride registers handler on the Server routing table if it can be reached
+// with method override, and reports whether it did.
+func (s *Server) handleOverride(pattern string, handler func(http.ResponseWriter, *http.Request)) bool {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !s.config().methodOverride || !ok || (method != http.MethodPost && !overridable(method)) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	route, ok := s.overrides[path]
+	if !ok {
+		route = &overrideRoute{handlers: map[string]func(http.ResponseWriter, *http.Request){}}
+		if s.overrides == nil {
+			s.overrides = map[string]*overrideRoute{}
+		}
+		s.overrides[path] = route
+		s.mux.HandleFunc(http.MethodPost+" "+path, s.dispatch(route))
+	}
+	if method == http.MethodPost {
+		route.post = handler
+		return true
+	}
+	route.handlers[method] = handler
+	s.mux.HandleFunc(pattern, handler)
+	return true
+}
+
+// dispatch returns the POST handler for route, which forwards overridden requests to the handler
+// of the method they carry.
+func (s *Server) dispatch(route *overrideRoute) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Header.Get(MethodOverrideHeader)
+		s.mu.Lock()
+		h := route.post
+		if method != "" {
+			h = route.handlers[strings.ToUpper(method)]
+		}
+		s.mu.Unlock()
+		if h == nil {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if method != "" {
+			r = r.Clone(r.Context())
+			r.Method = strings.ToUpper(method)
+			r.Header.Del(MethodOverrideHeader)
+		}
+		h(w, r)
+	}
+}
+
+// WithClientMethodOverride makes the transport send PUT, PATCH and DELETE requests as POST,
+// carrying the real method in the [MethodOverrideHeader].
+//
+// It is meant for clients behind proxies that only allow GET and POST. The server must be
+// created with [WithMethodOverride].
+func WithClientMethodOverride() TransportOption {
+	return func(t *Transport) {
+		t.prepare = append(t.prepare, func(_ context.Context, r *http.Request) error {
+			if overridable(r.Method) {
+				r.Header.Set(MethodOverrideHeader, r.Method)
+				r.Method = http.MethodPost
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package srpc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// expandPath replaces the wildcards of a [http.ServeMux] path pattern with the given values.
+//
+// Values of "{name}" wildcards are escaped as a single path segment, while values of
+// "{name...}" wildcards can span multiple segments.
+func expandPath(pattern string, values map[string]string) (string, error) {
+	if !strings.Contains(pattern, "{") {
+		return pattern, nil
+	}
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		if name == "$" {
+			segs[i] = ""
+			continue
+		}
+		name, multi := strings.CutSuffix(name, "...")
+		v, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("missing value for path wildcard %q", name)
+		}
+		if !multi {
+			segs[i] = url.PathEscape(v)
+			continue
+		}
+		parts := strings.Split(v, "/")
+		for j, p := range parts {
+			parts[j] = url.PathEscape(p)
+		}
+		segs[i] = strings.Join(parts, "/")
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// WithTrailingSlash makes endpoints also match the variant of their path with or without the trailing slash,
+// so that "/foo/" reaches the endpoint registered at "/foo" and vice versa.
+//
+// If redirect is true the variant responds with 308 Permanent Redirect to the registered path instead,
+// which preserves the method and the body of requests. Clients always call the registered path.
+//
+// Paths that end with a "{name...}" wildcard already match both variants and are not affected.
+// Endpoints must not be registered for both variants of the same path.
+func WithTrailingSlash(redirect bool) ServerOption {
+	return func(c *serverConfig) {
+		c.trailingSlash = true
+		c.slashRedirect = redirect
+	}
+}
+
+// slashVariant returns the pattern that matches the trailing-slash variant of the path pattern,
+// and false if the pattern doesn't have one.
+func slashVariant(pattern string) (string, bool) {
+	segs := strings.Split(pattern, "/")
+	last := segs[len(segs)-1]
+	switch {
+	case len(segs) < 2 || strings.HasSuffix(last, "...}"):
+		return "", false
+	case last == "{$}" || last == "":
+		trimmed := strings.Join(segs[:len(segs)-1], "/")
+		if trimmed == "" || !strings.Contains(trimmed, "/") {
+			// The root path has no variant.
+			return "", false
+		}
+		return trimmed, true
+	default:
+		return pattern + "/{$}", true
+	}
+}
+
+// slashHandler returns the handler for the trailing-slash variant of an endpoint served by h.
+func (c *serverConfig) slashHandler(h http.HandlerFunc) http.HandlerFunc {
+	if !c.slashRedirect {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := *r.URL
+		if p, ok := strings.CutSuffix(u.Path, "/"); ok {
+			u.Path = p
+		} else {
+			u.Path += "/"
+		}
+		u.RawPath = ""
+		http.Redirect(w, r, u.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,152 @@
+package srpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+)
+
+// progressFrame is a frame of the stream of an [EndpointP], which carries either a progress update or the result.
+type progressFrame[Progress, Response any] struct {
+	Kind     string   `json:"kind"`
+	Progress Progress `json:"progress,omitzero"`
+	Result   Response `json:"result,omitzero"`
+}
+
+const (
+	frameProgress = "progress"
+	frameResult   = "result"
+)
+
+type (
+	// EndpointP is like [Endpoint] for long-running procedures that report their progress
+	// before returning their response.
+	//
+	// Progress updates and the response are sent as frames of a single streamed response.
+	EndpointP[Progress, Response, Request any] Endpoint[iter.Seq2[progressFrame[Progress, Response], error], Request]
+	// ProcedureP is like [Procedure] for procedures that report their progress.
+	//
+	// Calls to report block until the update is sent, they are no-ops once the client went away
+	// or the procedure returned. report is safe for concurrent use, updates are sent one at a time.
+	ProcedureP[Progress, Response, Request any] func(ctx context.Context, req Request, report func(Progress)) (Response, error)
+	// RemoteP is the client side of an [EndpointP].
+	//
+	// It returns once the call started, the progress and the response are delivered by the returned call,
+	// whose [ProgressCall.Wait] must always be called.
+	RemoteP[Progress, Response, Request any] func(ctx context.Context, req Request) (*ProgressCall[Progress, Response], error)
+)
+
+// NewEndpointP constructs an [EndpointP] with JSON request, progress updates and response.
+func NewEndpointP[Progress, Response, Request any](method, path string, opts ...EndpointOption) EndpointP[Progress, Response, Request] {
+	return EndpointP[Progress, Response, Request](
+		NewEndpoint(method, path, NewCodecStream[progressFrame[Progress, Response]](), NewCodecJSON[Request](), opts...))
+}
+
+// Register is like [Endpoint.Register] for [EndpointP].
+//
+// Errors returned by the procedure are reported to the client in the response trailers.
+func (e *EndpointP[Progress, Response, Request]) Register(m Mux, h ProcedureP[Progress, Response, Request], opts ...ServerOption) {
+	type frame = progressFrame[Progress, Response]
+	(*Endpoint[iter.Seq2[frame, error], Request])(e).Register(m, func(ctx context.Context, req Request) (iter.Seq2[frame, error], error) {
+		return func(yield func(frame, error) bool) {
+			var (
+				mu      sync.Mutex
+				stopped bool
+			)
+			report := func(p Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+				if !stopped && !yield(frame{Kind: frameProgress, Progress: p}, nil) {
+					stopped = true
+				}
+			}
+			resp, err := h(ctx, req, report)
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped {
+				return
+			}
+			// Updates reported by goroutines that outlive the procedure are dropped.
+			stopped = true
+			if err != nil {
+				yield(frame{}, err)
+				return
+			}
+			yield(frame{Kind: frameResult, Result: resp}, nil)
+		}, nil
+	}, opts...)
+}
+
+// Remote is like [Endpoint.Remote] for [EndpointP].
+func (e *EndpointP[Progress, Response, Request]) Remote(conn *Transport) RemoteP[Progress, Response, Request] {
+	cl := (*Endpoint[iter.Seq2[progressFrame[Progress, Response], error], Request])(e).Remote(conn)
+	return func(ctx context.Context, req Request) (*ProgressCall[Progress, Response], error) {
+		seq, err := cl(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		c := &ProgressCall[Progress, Response]{progress: make(chan Progress), done: make(chan struct{})}
+		go c.run(ctx, seq)
+		return c, nil
+	}
+}
+
+// RemoteWithOrigin is like [Endpoint.RemoteWithOrigin] for [EndpointP].
+func (e *EndpointP[Progress, Response, Request]) RemoteWithOrigin(origin string) RemoteP[Progress, Response, Request] {
+	return e.Remote(originTransport(origin))
+}
+
+// ProgressCall is a call to an [EndpointP].
+//
+// Like the body of an [http.Response], calls must always be ended by calling [ProgressCall.Wait]:
+// calls whose progress is not received keep their connection and goroutine until their context is done.
+type ProgressCall[Progress, Response any] struct {
+	progress chan Progress
+	done     chan struct{}
+	resp     Response
+	err      error
+}
+
+// Progress returns the channel of progress updates, which is closed when the call ends.
+//
+// The call ends with the error of its context if it is done while an update is not received.
+func (c *ProgressCall[Progress, Response]) Progress() <-chan Progress { return c.progress }
+
+// Wait waits for the call to end and returns its response.
+//
+// Progress updates that were not received from [ProgressCall.Progress] are discarded.
+func (c *ProgressCall[Progress, Response]) Wait() (Response, error) {
+	for range c.progress { //nolint: revive // only draining the channel.
+	}
+	<-c.done
+	return c.resp, c.err
+}
+
+// run reads the frames of seq until the result, or until ctx is done.
+func (c *ProgressCall[Progress, Response]) run(ctx context.Context, seq iter.Seq2[progressFrame[Progress, Response], error]) {
+	defer close(c.done)
+	defer close(c.progress)
+	c.err = fmt.Errorf("reading result: %w", io.ErrUnexpectedEOF)
+	for f, err := range seq {
+		switch {
+		case err != nil:
+			c.err = err
+			return
+		case f.Kind == frameProgress:
+			select {
+			case c.progress <- f.Progress:
+			case <-ctx.Done():
+				c.err = ctx.Err()
+				return
+			}
+		case f.Kind == frameResult:
+			c.resp, c.err = f.Result, nil
+			return
+		default:
+			c.err = fmt.Errorf("unknown frame kind: %q", f.Kind)
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type JobStatus struct {
+	Percent int
+}
+
+func TestEndpointP(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointP[JobStatus, Resp, Req](http.MethodPost, "/jobs")
+	ep.Register(mux, func(ctx context.Context, req Req, report func(JobStatus)) (Resp, error) {
+		for p := 25; p < 100; p += 25 {
+			report(JobStatus{p})
+		}
+		if req.B == "fail" {
+			return Resp{}, srpc.Forbidden("not allowed")
+		}
+		return Resp{"done " + req.B}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	call := ep.RemoteWithOrigin(srv.URL)
+
+	t.Run("Result", func(t *testing.T) {
+		c := tst.Do(call(ctx, Req{"job"}))(t)
+		var got []JobStatus
+		for p := range c.Progress() {
+			got = append(got, p)
+		}
+		tst.Is([]JobStatus{{25}, {50}, {75}}, got, t)
+		tst.Is(Resp{"done job"}, tst.Do(c.Wait())(t), t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		c := tst.Do(call(ctx, Req{"fail"}))(t)
+		_, err := c.Wait()
+		tst.Is(true, errors.Is(err, srpc.ErrForbidden), t)
+		tst.Err("not allowed", err, t)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		c := tst.Do(call(cctx, Req{"job"}))(t)
+		cancel()
+		_, err := c.Wait()
+		tst.Is(true, errors.Is(err, context.Canceled), t)
+	})
+}
+
+func TestEndpointPConcurrentReports(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointP[JobStatus, Resp, Req](http.MethodPost, "/jobs")
+	const workers = 10
+	ep.Register(mux, func(ctx context.Context, req Req, report func(JobStatus)) (Resp, error) {
+		var wg sync.WaitGroup
+		for i := range workers {
+			wg.Go(func() { report(JobStatus{i}) })
+		}
+		wg.Wait()
+		return Resp{"done"}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	c := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+	var got int
+	for range c.Progress() {
+		got++
+	}
+	tst.Is(workers, got, t)
+	tst.Is(Resp{"done"}, tst.Do(c.Wait())(t), t)
+}
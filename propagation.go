@@ -0,0 +1,96 @@
+package srpc
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// Propagator carries values of the context across calls, in request headers.
+//
+// Clients inject the values of the context of the call, and servers extract them into the context
+// passed to procedures. For example, a propagator for W3C baggage injects and extracts the "baggage" header.
+type Propagator interface {
+	// Inject sets the headers that carry the values of ctx.
+	Inject(ctx context.Context, h http.Header)
+	// Extract returns a context derived from ctx that carries the values found in h.
+	Extract(ctx context.Context, h http.Header) context.Context
+}
+
+// WithPropagators makes endpoints extract the values carried by request headers into the context
+// of procedures, using ps in order.
+func WithPropagators(ps ...Propagator) ServerOption {
+	return func(c *serverConfig) {
+		c.propagators = append(slices.Clip(c.propagators), ps...)
+	}
+}
+
+// WithClientPropagators makes the transport inject the values of the context of calls into
+// the request headers, using ps in order.
+//
+// Headers are injected after the ones set with [WithHeaders] and [WithCallHeader].
+func WithClientPropagators(ps ...Propagator) TransportOption {
+	return func(t *Transport) {
+		t.prepare = append(t.prepare, func(ctx context.Context, r *http.Request) error {
+			for _, p := range ps {
+				p.Inject(ctx, r.Header)
+			}
+			return nil
+		})
+	}
+}
+
+// extract returns ctx with the values extracted from h by ps.
+func extract(ctx context.Context, h http.Header, ps []Propagator) context.Context {
+	for _, p := range ps {
+		ctx = p.Extract(ctx, h)
+	}
+	return ctx
+}
+
+// HeaderPropagator returns a [Propagator] that carries the value of the named header as is,
+// for example a tenant ID.
+//
+// Servers read the value with [PropagatedValue]. Since the value stays in the context, calls made by
+// procedures with their context forward it to other services that use the same propagator.
+// Clients set it with [WithPropagatedValue].
+func HeaderPropagator(name string) Propagator {
+	return headerPropagator(http.CanonicalHeaderKey(name))
+}
+
+type headerPropagator string
+
+// Inject implements [Propagator].
+func (p headerPropagator) Inject(ctx context.Context, h http.Header) {
+	if v := PropagatedValue(ctx, string(p)); v != "" {
+		h.Set(string(p), v)
+	}
+}
+
+// Extract implements [Propagator].
+func (p headerPropagator) Extract(ctx context.Context, h http.Header) context.Context {
+	if v := h.Get(string(p)); v != "" {
+		return WithPropagatedValue(ctx, string(p), v)
+	}
+	return ctx
+}
+
+// WithPropagatedValue returns a context that carries value for the propagator returned
+// by [HeaderPropagator] for the named header.
+func WithPropagatedValue(ctx context.Context, name, value string) context.Context {
+	vals, _ := ctx.Value(propagatedKey{}).(map[string]string)
+	vals = maps.Clone(vals)
+	if vals == nil {
+		vals = map[string]string{}
+	}
+	vals[http.CanonicalHeaderKey(name)] = value
+	return context.WithValue(ctx, propagatedKey{}, vals)
+}
+
+// PropagatedValue returns the value carried by ctx for the propagator returned by [HeaderPropagator]
+// for the named header, or "" if there is none.
+func PropagatedValue(ctx context.Context, name string) string {
+	vals, _ := ctx.Value(propagatedKey{}).(map[string]string)
+	return vals[http.CanonicalHeaderKey(name)]
+}
@@ -0,0 +1,207 @@
+package srpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+type queryField struct {
+	index int
+	name  string
+}
+
+// queryFields returns the query parameters of the struct type t.
+//
+// It panics if t is not a struct or if a field has an unsupported type.
+func queryFields(t reflect.Type) []queryField {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("query codec requires a struct type, %v provided", t))
+	}
+	var fields []queryField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		name := sf.Tag.Get("query")
+		if name == "-" || !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if !scalarKind(ft.Kind()) {
+			panic(fmt.Sprintf("unsupported type %v for query parameter %q", sf.Type, name))
+		}
+		fields = append(fields, queryField{index: i, name: name})
+	}
+	return fields
+}
+
+// scalarKind reports whether values of kind k can be a query parameter value.
+func scalarKind(k reflect.Kind) bool {
+	switch k { //nolint: exhaustive // all other kinds are unsupported.
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewCodecQuery creates a Codec that maps structs to URL-encoded query strings, as used by [NewEndpointQuery].
+//
+// Fields are named after their `query:"name"` tag, or after the field name if the tag is missing.
+// Fields tagged with `query:"-"` are ignored.
+// Supported field types are strings, booleans, integers and floats, pointers to them, which are omitted
+// when nil, and slices of them, which are sent as repeated parameters. Other fields are omitted when they
+// have the zero value.
+//
+// It panics if T is not a struct or if a field has an unsupported type.
+func NewCodecQuery[T any]() Codec[T] {
+	fields := queryFields(reflect.TypeFor[T]())
+	return Codec[T]{
+		ContentType: formContentType,
+		Co: func(_ context.Context, t T) (io.Reader, error) {
+			v := reflect.ValueOf(t)
+			q := url.Values{}
+			for _, f := range fields {
+				fv := v.Field(f.index)
+				switch {
+				case fv.Kind() == reflect.Slice:
+					for i := range fv.Len() {
+						q.Add(f.name, formatQueryValue(fv.Index(i)))
+					}
+				case fv.IsZero():
+				case fv.Kind() == reflect.Pointer:
+					q.Set(f.name, formatQueryValue(fv.Elem()))
+				default:
+					q.Set(f.name, formatQueryValue(fv))
+				}
+			}
+			return strings.NewReader(q.Encode()), nil
+		},
+		Dec: func(_ context.Context, r io.Reader) (t T, err error) {
+			buf, err := io.ReadAll(r)
+			if err != nil {
+				return t, err
+			}
+			q, err := url.ParseQuery(string(buf))
+			if err != nil {
+				return t, err
+			}
+			v := reflect.ValueOf(&t).Elem()
+			for _, f := range fields {
+				if !q.Has(f.name) {
+					continue
+				}
+				if err := setQueryField(v.Field(f.index), q[f.name]); err != nil {
+					return t, fmt.Errorf("query parameter %q: %w", f.name, err)
+				}
+			}
+			return t, nil
+		},
+	}
+}
+
+// setQueryField sets the field v to the values of its query parameter.
+func setQueryField(v reflect.Value, values []string) error {
+	switch v.Kind() { //nolint: exhaustive // other kinds are scalars.
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, val := range values {
+			if err := parseQueryValue(s.Index(i), val); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := parseQueryValue(p.Elem(), values[0]); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	default:
+		return parseQueryValue(v, values[0])
+	}
+}
+
+func formatQueryValue(v reflect.Value) string {
+	switch v.Kind() { //nolint: exhaustive // queryFields only allows the handled kinds.
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	default:
+		return v.String()
+	}
+}
+
+func parseQueryValue(v reflect.Value, s string) error {
+	switch v.Kind() { //nolint: exhaustive // queryFields only allows the handled kinds.
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		v.SetString(s)
+	}
+	return nil
+}
+
+// WithStripQueryKey makes endpoints remove the query parameter that carries requests sent in the URL,
+// see [QueryKey], from the served request once it is decoded.
+//
+// Middlewares that wrap the [Mux], like access loggers, then don't see the encoded request.
+// It has no effect on state-changing endpoints and on endpoints that map requests to query parameters.
+func WithStripQueryKey() ServerOption {
+	return func(c *serverConfig) { c.stripQueryKey = true }
+}
+
+// stripQuery removes the named query parameter from the URL of r.
+func stripQuery(r *http.Request, name string) {
+	q := r.URL.Query()
+	if !q.Has(name) {
+		return
+	}
+	q.Del(name)
+	r.URL.RawQuery = q.Encode()
+	r.RequestURI = r.URL.RequestURI()
+}
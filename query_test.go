@@ -0,0 +1,106 @@
+package srpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type Search struct {
+	Term   string  `query:"q"`
+	Limit  int     `query:"limit"`
+	Exact  bool    `query:"exact"`
+	Score  float64 `query:"score"`
+	Secret string  `query:"-"`
+}
+
+func TestQuery(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointQuery[Search, Search]("/search")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Search) (Search, error) {
+		return req, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("Remote", func(t *testing.T) {
+		req := Search{Term: "go lang", Limit: 10, Exact: true, Score: 0.5, Secret: "dropped"}
+		got := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, req))(t)
+		req.Secret = ""
+		tst.Is(req, got, t)
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		hReq := tst.Do(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/search?q=x&limit=3", nil))(t)
+		hResp := tst.Do(srv.Client().Do(hReq))(t)
+		defer func() { tst.No(hResp.Body.Close(), t) }()
+		var got Search
+		tst.No(json.NewDecoder(hResp.Body).Decode(&got), t)
+		tst.Is(Search{Term: "x", Limit: 3}, got, t)
+	})
+
+	t.Run("BadValue", func(t *testing.T) {
+		hReq := tst.Do(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/search?limit=many", nil))(t)
+		hResp := tst.Do(srv.Client().Do(hReq))(t)
+		defer func() { tst.No(hResp.Body.Close(), t) }()
+		tst.Is(http.StatusBadRequest, hResp.StatusCode, t)
+	})
+}
+
+type Filter struct {
+	Tags    []string `query:"tag"`
+	IDs     []int    `query:"id"`
+	MinAge  *int     `query:"min_age"`
+	Deleted *bool    `query:"deleted"`
+}
+
+func TestCodecQuery(t *testing.T) {
+	ctx := tst.Go(t)
+	c := srpc.NewCodecQuery[Filter]()
+
+	zero, no := 0, false
+	f := Filter{Tags: []string{"a", "b c"}, IDs: []int{1, 2}, MinAge: &zero, Deleted: &no}
+	r := tst.Do(c.Co(ctx, f))(t)
+	enc := string(tst.Do(io.ReadAll(r))(t))
+	tst.Is("deleted=false&id=1&id=2&min_age=0&tag=a&tag=b+c", enc, t)
+	tst.Is(f, tst.Do(c.Dec(ctx, strings.NewReader(enc)))(t), t)
+
+	// Nil pointers and empty slices are omitted.
+	r = tst.Do(c.Co(ctx, Filter{}))(t)
+	tst.Is("", string(tst.Do(io.ReadAll(r))(t)), t)
+	tst.Is(Filter{}, tst.Do(c.Dec(ctx, strings.NewReader("")))(t), t)
+
+	_, err := c.Dec(ctx, strings.NewReader("id=1&id=x"))
+	tst.Err(`query parameter "id"`, err, t)
+}
+
+func TestStripQueryKey(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/strip")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B}, nil
+	}, srpc.WithStripQueryKey())
+	var logged []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		logged = append(logged, r.URL.String(), r.RequestURI)
+	}))
+	defer srv.Close()
+
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil, srpc.WithRequestConstructor(
+		func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, method, url+"&page=2", body)
+		})))(t)
+	got := tst.Do(ep.Remote(conn)(ctx, Req{"secret"}))(t)
+	tst.Is(Resp{"secret"}, got, t)
+	tst.Is([]string{"/strip?page=2", "/strip?page=2"}, logged, t)
+}
@@ -0,0 +1,49 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// panicKind is the [ErrorKindHeader] value of responses to requests whose procedure panicked.
+const panicKind = "panic"
+
+// ErrServerPanic matches, with [errors.Is], the errors returned by remote procedures
+// whose server recovered from a panic with [WithPanicRecovery].
+//
+// These errors also match [ErrInternal]. They are caused by server bugs, so retrying the call
+// might fail in the same way.
+var ErrServerPanic = errors.New("server panicked")
+
+// WithPanicRecovery makes endpoints recover from panics of procedures and respond with
+// 500 Internal Server Error, marked so that clients can detect it with [ErrServerPanic].
+//
+// The panic and its stack trace are logged, they are not sent to the client.
+// If the response was already started the connection is aborted instead, as the server does by default.
+func WithPanicRecovery() ServerOption {
+	return func(c *serverConfig) { c.recoverPanics = true }
+}
+
+// recoverPanic recovers from a panic of the procedure serving a request with w.
+// It must be deferred directly.
+func recoverPanic(ctx context.Context, w *responseRecorder) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if r == http.ErrAbortHandler { //nolint: errorlint // this is the sentinel value, not an error to match.
+		panic(r)
+	}
+	slog.LogAttrs(ctx, slog.LevelError, "Handler Panic",
+		slog.String("error", fmt.Sprint(r)),
+		slog.String("stack", string(debug.Stack())))
+	if w.status != 0 {
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set(ErrorKindHeader, panicKind)
+	http.Error(w, "Internal server error.", http.StatusInternalServerError)
+}
@@ -0,0 +1,146 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	backoffBase = 100 * time.Millisecond
+	backoffMax  = 10 * time.Second
+)
+
+// RetryPolicy configures how a [Transport] retries failed calls.
+//
+// Only calls to endpoints with idempotent methods (GET, HEAD, OPTIONS, PUT and DELETE), and calls that
+// carry an [IdempotencyKeyHeader], are retried, and only if the request could not be issued or the server responded with
+// 429, 502, 503 or 504.
+//
+// When the server responds 429 or 503 with a Retry-After header, the delay it asks for
+// overrides the backoff schedule.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a single call, including the first one.
+	MaxAttempts int
+	// Backoff returns how long to wait before the n-th retry, starting from 1.
+	//
+	// If nil, [ExponentialBackoff] is used.
+	Backoff func(n int) time.Duration
+	// MaxRetryAfter is the longest Retry-After delay that is honored.
+	//
+	// If the server asks to wait longer than this the call fails instead.
+	// Zero means no limit.
+	MaxRetryAfter time.Duration
+	// Jitter randomizes the delays returned by Backoff, so that clients that failed at the same time
+	// don't retry in sync. Delays requested with Retry-After are not randomized.
+	//
+	// If nil, delays are used as they are. See [FullJitter].
+	Jitter func(d time.Duration) time.Duration
+}
+
+// WithRetry makes the [Transport] retry failed calls according to p.
+func WithRetry(p RetryPolicy) TransportOption {
+	return func(t *Transport) {
+		t.retry = &p
+	}
+}
+
+// ExponentialBackoff waits 100ms before the first retry and doubles the delay
+// for every subsequent one, up to 10s.
+func ExponentialBackoff(n int) time.Duration {
+	d := backoffBase
+	for range n - 1 {
+		d *= 2
+		if d >= backoffMax {
+			return backoffMax
+		}
+	}
+	return d
+}
+
+// FullJitter returns a random delay between 0 and d, which spreads retries the most.
+func FullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return rand.N(d + 1)
+}
+
+// next reports whether the given attempt should be retried and how long to wait before doing so.
+func (p *RetryPolicy) next(ctx context.Context, attempt int, retriable bool, resp *http.Response, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || !retriable || ctx.Err() != nil {
+		return 0, false
+	}
+	backoff := p.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff
+	}
+	if jitter := p.Jitter; jitter != nil {
+		base := backoff
+		backoff = func(n int) time.Duration { return jitter(base(n)) }
+	}
+	if err != nil {
+		return backoff(attempt), !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if p.MaxRetryAfter > 0 && d > p.MaxRetryAfter {
+				return 0, false
+			}
+			return d, true
+		}
+		return backoff(attempt), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return backoff(attempt), true
+	default:
+		return 0, false
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, in either the delta-seconds or the HTTP-date form.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		if secs > math.MaxInt64/int(time.Second) {
+			// Larger delays overflow, they are clamped so that they still exceed MaxRetryAfter.
+			return math.MaxInt64, true
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+// sleep waits for d or until ctx is done, whichever happens first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
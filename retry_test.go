@@ -0,0 +1,233 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tst.Go(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"10000000000", math.MaxInt64, true},
+		{"Thu, 01 Jan 2026 00:00:10 GMT", 10 * time.Second, true},
+		{"Wed, 31 Dec 2025 23:59:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := srpc.ParseRetryAfter(tt.in, now)
+			tst.Is(tt.ok, ok, t)
+			tst.Is(tt.want, got, t)
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/retry")
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if calls.Add(1) < 3 {
+			return Resp{}, &srpc.WireError{Code: http.StatusServiceUnavailable, Msg: "busy"}
+		}
+		return Resp{"ok" + req.B}, nil
+	})
+	retryAfter := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "0")
+			h.ServeHTTP(w, r)
+		})
+	}
+	srv := httptest.NewServer(retryAfter(mux))
+	defer srv.Close()
+
+	t.Run("Recovers", func(t *testing.T) {
+		calls.Store(0)
+		conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithRetry(srpc.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     func(int) time.Duration { return time.Hour },
+		})))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, Req{"!"}))(t)
+		tst.Is(Resp{"ok!"}, got, t)
+		tst.Is(int32(3), calls.Load(), t)
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		calls.Store(0)
+		conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithRetry(srpc.RetryPolicy{MaxAttempts: 2})))(t)
+		_, err := ep.Remote(conn)(ctx, Req{"!"})
+		tst.Err("busy", err, t)
+		tst.Is(int32(2), calls.Load(), t)
+	})
+}
+
+func TestJitter(t *testing.T) {
+	ctx := tst.Go(t)
+	seen := map[time.Duration]bool{}
+	for range 100 {
+		d := srpc.FullJitter(time.Second)
+		tst.Is(true, d >= 0 && d <= time.Second, t)
+		seen[d] = true
+	}
+	tst.Is(true, len(seen) > 1, t)
+	tst.Is(time.Duration(0), srpc.FullJitter(0), t)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"A":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	var jittered []time.Duration
+	conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithRetry(srpc.RetryPolicy{
+		MaxAttempts: 2,
+		Backoff:     func(int) time.Duration { return time.Hour },
+		Jitter: func(d time.Duration) time.Duration {
+			jittered = append(jittered, d)
+			return 0
+		},
+	})))(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/")
+	got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"ok"}, got, t)
+	tst.Is([]time.Duration{time.Hour}, jittered, t)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/breaker")
+	var (
+		calls   atomic.Int32
+		healthy atomic.Bool
+	)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		calls.Add(1)
+		if !healthy.Load() {
+			return Resp{}, srpc.ErrServiceUnavailable
+		}
+		return Resp{"ok"}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	const cooldown = 50 * time.Millisecond
+	var transitions []string
+	conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithCircuitBreaker(srpc.CircuitBreaker{
+		Threshold: 2,
+		Cooldown:  cooldown,
+		OnStateChange: func(from, to srpc.CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})))(t)
+	call := ep.Remote(conn)
+	wait := func() {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(cooldown):
+		}
+	}
+
+	for range 2 {
+		_, err := call(ctx, Req{})
+		tst.Is(true, errors.Is(err, srpc.ErrServiceUnavailable), t)
+	}
+	_, err := call(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrCircuitOpen), t)
+	tst.Is(int32(2), calls.Load(), t)
+
+	// The probe fails and the circuit opens again.
+	wait()
+	_, err = call(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrServiceUnavailable), t)
+	_, err = call(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrCircuitOpen), t)
+	tst.Is(int32(3), calls.Load(), t)
+
+	// The probe succeeds and the circuit closes.
+	healthy.Store(true)
+	wait()
+	got := tst.Do(call(ctx, Req{}))(t)
+	tst.Is(Resp{"ok"}, got, t)
+	tst.Do(call(ctx, Req{}))(t)
+	tst.Is(int32(5), calls.Load(), t)
+
+	tst.Is([]string{
+		"closed->open",
+		"open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}, transitions, t)
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	tst.Go(t)
+	var transitions []string
+	allow, done := srpc.NewBreaker(srpc.CircuitBreaker{
+		Threshold: 1,
+		OnStateChange: func(from, to srpc.CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	stale := tst.Do(allow())(t)
+	tst.Is(false, stale, t)
+	slow := tst.Do(allow())(t)
+	failing := tst.Do(allow())(t)
+	done(failing, true, true)
+	probe := tst.Do(allow())(t)
+	tst.Is(true, probe, t)
+
+	// Calls issued before the circuit opened don't end the probe.
+	done(stale, true, true)
+	_, err := allow()
+	tst.Is(true, errors.Is(err, srpc.ErrCircuitOpen), t)
+	// Nor close the circuit.
+	done(slow, true, false)
+	_, err = allow()
+	tst.Is(true, errors.Is(err, srpc.ErrCircuitOpen), t)
+
+	done(probe, true, false)
+	tst.Is([]string{"closed->open", "open->half-open", "half-open->closed"}, transitions, t)
+}
+
+func TestCircuitBreakerClientTimeout(t *testing.T) {
+	ctx := tst.Go(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	cl := srv.Client()
+	cl.Timeout = 10 * time.Millisecond
+	conn := tst.Do(srpc.NewTransport(srv.URL, cl, nil, srpc.WithCircuitBreaker(srpc.CircuitBreaker{
+		Threshold: 1,
+		Cooldown:  time.Hour,
+	})))(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/")
+
+	_, err := ep.Remote(conn)(ctx, Req{})
+	tst.Is(true, errors.Is(err, context.DeadlineExceeded), t)
+	_, err = ep.Remote(conn)(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrCircuitOpen), t)
+}
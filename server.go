@@ -0,0 +1,410 @@
+package srpc
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a [Mux] that carries options shared by all the endpoints registered on it.
+//
+// Endpoints registered on a Server with [Endpoint.Register] are served according to its options.
+//
+// The context passed to procedures is canceled when the Server is closed, which allows
+// long-lived streaming procedures to return promptly on shutdown. To coordinate with
+// [http.Server.Shutdown], which waits for all handlers to return, use:
+//
+//	httpSrv.RegisterOnShutdown(srv.Close)
+type Server struct {
+	mux  Mux
+	opts []ServerOption
+
+	ctx    context.Context //nolint: containedctx // this is the lifecycle of the server.
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	overrides map[string]*overrideRoute
+	endpoints []EndpointInfo
+	// allowed holds the methods registered for each path, if [WithMethodNotAllowed] is used.
+	allowed map[string][]string
+}
+
+// NewServer wraps m in a Server with the given options.
+func NewServer(m Mux, opts ...ServerOption) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{mux: m, opts: opts, ctx: ctx, cancel: cancel}
+}
+
+// Close cancels the context of all in-flight procedures registered on the Server.
+//
+// Requests received after Close are rejected with 503 Service Unavailable.
+func (s *Server) Close() {
+	s.cancel()
+}
+
+// HandleFunc implements [Mux].
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.allow(pattern)
+	if s.handleOverride(pattern, handler) {
+		return
+	}
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// EndpointInfo describes an endpoint registered on a [Server].
+type EndpointInfo struct {
+	Method string
+	// Path is the path pattern of the endpoint, including wildcards.
+	Path string
+
+	Request             reflect.Type
+	RequestContentType  string
+	Response            reflect.Type
+	ResponseContentType string
+
+	// rawQuery is set for endpoints that map requests to query parameters.
+	rawQuery bool
+	queryKey string
+}
+
+// info describes e.
+func (e *Endpoint[Response, Request]) info() EndpointInfo {
+	return EndpointInfo{
+		Method:              e.method,
+		Path:                e.path,
+		Request:             reflect.TypeFor[Request](),
+		RequestContentType:  e.reqc.ContentType,
+		Response:            reflect.TypeFor[Response](),
+		ResponseContentType: e.resc.ContentType,
+		rawQuery:            e.rawQuery,
+		queryKey:            e.opts.queryKey,
+	}
+}
+
+func (s *Server) record(info EndpointInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoints = append(s.endpoints, info)
+}
+
+// Endpoints returns the endpoints registered on the Server, in registration order.
+//
+// It can be used to generate documentation or clients.
+func (s *Server) Endpoints() []EndpointInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.endpoints)
+}
+
+// RegisterNotFound registers on m a handler for all the requests under prefix that don't match a registered
+// endpoint, which responds with 404 Not Found and an error message, as endpoints do.
+//
+// This makes clients receive consistent errors for unknown paths instead of the default response of the mux.
+// If m is a [*http.ServeMux], or a [Server] that wraps one, requests for paths that have endpoints with
+// other methods are still rejected with 405 Method Not Allowed and an Allow header that lists the methods.
+func RegisterNotFound(m Mux, prefix string) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if s, ok := m.(*Server); ok {
+		m = s.mux
+	}
+	finder, _ := m.(handlerFinder)
+	m.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+		if allowed := allowedMethods(finder, r); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+		http.Error(w, "Endpoint not found.", http.StatusNotFound)
+	})
+}
+
+// handlerFinder is implemented by muxes that can tell which pattern matches a request, like [http.ServeMux].
+type handlerFinder interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// probedMethods are the methods allowedMethods looks for.
+var probedMethods = []string{
+	http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPatch, http.MethodPost, http.MethodPut,
+}
+
+// allowedMethods returns the methods that have a pattern with a method for the path of r in f, sorted.
+func allowedMethods(f handlerFinder, r *http.Request) []string {
+	if f == nil {
+		return nil
+	}
+	var allowed []string
+	for _, method := range probedMethods {
+		probe := *r
+		probe.Method = method
+		if _, pattern := f.Handler(&probe); strings.Contains(pattern, " ") {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// WithMethodNotAllowed makes a [Server] respond to requests for registered paths with a method
+// that has no endpoint with 405 Method Not Allowed, an error message, as endpoints do,
+// and an Allow header that lists the registered methods.
+//
+// It registers a handler for every path that has endpoints, regardless of the method, so patterns without
+// a method must not be registered on the Server for the same paths.
+// It must be passed to [NewServer], it has no effect on single endpoints.
+func WithMethodNotAllowed() ServerOption {
+	return func(c *serverConfig) { c.methodNotAllowed = true }
+}
+
+// allow records the method of pattern among the allowed ones for its path, and registers
+// the method-not-allowed handler the first time the path is seen.
+func (s *Server) allow(pattern string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || !s.config().methodNotAllowed {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods, seen := s.allowed[path]
+	if !slices.Contains(methods, method) {
+		methods = append(methods, method)
+		if method == http.MethodGet && !slices.Contains(methods, http.MethodHead) {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if s.allowed == nil {
+		s.allowed = map[string][]string{}
+	}
+	s.allowed[path] = methods
+	if seen {
+		return
+	}
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		allowed := slices.Sorted(slices.Values(s.allowed[path]))
+		s.mu.Unlock()
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+	})
+}
+
+// config returns the configuration shared by all the endpoints registered on s.
+func (s *Server) config() serverConfig {
+	var cfg serverConfig
+	for _, o := range s.opts {
+		o(&cfg)
+	}
+	return cfg
+}
+
+// ServerOption configures how endpoints are served.
+//
+// Options can be set for all endpoints with [NewServer] or for a single one with [Endpoint.Register].
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	// lifecycle is done when the Server the endpoint is registered on is closed.
+	lifecycle context.Context //nolint: containedctx // this is the lifecycle of the server.
+
+	verifier   Verifier
+	auth       Authenticator
+	metrics    ServerMetrics
+	ctxHeaders []string
+
+	// propagators extract values from request headers into the context of procedures.
+	propagators []Propagator
+
+	// debugErrors makes responses include details about request decoding failures.
+	debugErrors bool
+
+	// maxRequestBytes limits the size of request bodies, if positive.
+	maxRequestBytes int64
+
+	// strictContentType makes requests with a body fail if their Content-Type doesn't match the codec.
+	strictContentType bool
+
+	// stripQueryKey removes the encoded request from the URL of served requests.
+	stripQueryKey bool
+
+	// maxTimeout caps the timeouts propagated by clients, they are ignored if it is not positive.
+	maxTimeout time.Duration
+
+	// maxConcurrent limits the requests each endpoint serves at a time, if positive.
+	// Requests wait for queueTimeout before being rejected.
+	maxConcurrent int
+	queueTimeout  time.Duration
+
+	// keepAlive is the interval after which idle event streams send a comment, if positive.
+	keepAlive time.Duration
+
+	// decodeTimeout limits the time to decode requests, if positive.
+	decodeTimeout time.Duration
+
+	// trailingSlash makes endpoints also match their path with or without the trailing slash,
+	// slashRedirect makes the variant redirect to the registered path.
+	trailingSlash bool
+	slashRedirect bool
+
+	// encodings are the content codings responses can be compressed with, in order of preference,
+	// responses smaller than compressMinSize are not compressed.
+	encodings       []Encoding
+	compressMinSize int64
+
+	// requestEncodings are the content codings request bodies are decompressed from, they are
+	// ignored if empty. Decompressed bodies are limited to maxDecompressedBytes.
+	requestEncodings     []Encoding
+	maxDecompressedBytes int64
+
+	// trustedProxies are the ranges of the proxies whose forwardedHeader is trusted to find client IPs.
+	trustedProxies  []netip.Prefix
+	forwardedHeader string
+
+	// accessLog makes endpoints log a line for every request they serve.
+	accessLog bool
+
+	// logBodies makes endpoints log request and response bodies, after applying redact.
+	logBodies bool
+	redact    BodyRedactor
+
+	// auditor receives the encoded requests before they are served, if not nil.
+	auditor Auditor
+
+	// methodOverride makes the Server route POST requests according to the [MethodOverrideHeader].
+	methodOverride bool
+
+	// idempotency deduplicates requests that carry an idempotency key, if not nil.
+	idempotency IdempotencyStore
+
+	// recoverPanics makes endpoints respond 500 to requests whose procedure panicked.
+	recoverPanics bool
+
+	// methodNotAllowed makes the Server respond 405 to requests with a method that has no endpoint.
+	methodNotAllowed bool
+
+	// batchMaxItems and batchConcurrency limit the batches served by [RegisterBatch], if positive.
+	batchMaxItems    int
+	batchConcurrency int
+}
+
+// newServerConfig returns the configuration for an endpoint registered on m with opts.
+func newServerConfig(m Mux, opts []ServerOption) serverConfig {
+	cfg := serverConfig{lifecycle: context.Background(), metrics: nopServerMetrics{}}
+	if s, ok := m.(*Server); ok {
+		cfg.lifecycle = s.ctx
+		for _, o := range s.opts {
+			o(&cfg)
+		}
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return cfg
+}
+
+// Authenticator authenticates requests before they are decoded.
+type Authenticator interface {
+	// Authenticate returns the context to pass to the procedure, usually augmented with
+	// the identity of the caller.
+	//
+	// If it returns an error the request is rejected with the error status if it implements
+	// [ErrorResponse], or with 401 Unauthorized otherwise.
+	Authenticate(ctx context.Context, r *http.Request) (context.Context, error)
+}
+
+// AuthenticatorFunc is an adapter to use ordinary functions as [Authenticator].
+type AuthenticatorFunc func(ctx context.Context, r *http.Request) (context.Context, error)
+
+// Authenticate implements [Authenticator].
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, r *http.Request) (context.Context, error) {
+	return f(ctx, r)
+}
+
+// WithAuthenticator makes endpoints authenticate requests with a, before decoding them.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(c *serverConfig) {
+		c.auth = a
+	}
+}
+
+// responseRecorder is a [http.ResponseWriter] that keeps track of the response status.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if code < http.StatusOK {
+		// Informational responses precede the final one.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		// The status was already sent, for example by a procedure with [SetStatus].
+		return
+	}
+	if code == http.StatusNotFound && w.Header().Get(ErrorKindHeader) == "" {
+		// The endpoint exists, so clients must not mistake this for a missing endpoint.
+		w.Header().Set(ErrorKindHeader, notFoundKind)
+	}
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(buf []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// Flush implements [http.Flusher], it is a no-op if the underlying writer does not support flushing.
+func (w *responseRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows [http.ResponseController] to access the underlying writer.
+func (w *responseRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// statusCode returns the status that was sent, or 200 if the response was left empty.
+func (w *responseRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// WithHeadersInContext makes the named request headers available to procedures via [HeaderFromContext].
+func WithHeadersInContext(names ...string) ServerOption {
+	return func(c *serverConfig) {
+		for _, n := range names {
+			c.ctxHeaders = append(slices.Clip(c.ctxHeaders), http.CanonicalHeaderKey(n))
+		}
+	}
+}
+
+// WithDebugErrors makes the server include the reason why a request could not be decoded
+// in the 400 response, for example the JSON field that had the wrong type.
+//
+// Details might disclose implementation information, so this is meant for development
+// and for APIs used by trusted integrators.
+func WithDebugErrors() ServerOption {
+	return func(c *serverConfig) { c.debugErrors = true }
+}
+
+// WithStrictContentType makes the server reject requests whose body Content-Type doesn't match
+// the one of the request codec with 415 Unsupported Media Type.
+//
+// Media type parameters, like charset, are ignored.
+func WithStrictContentType() ServerOption {
+	return func(c *serverConfig) { c.strictContentType = true }
+}
@@ -0,0 +1,712 @@
+package srpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+type userKey struct{}
+
+func TestAuthenticator(t *testing.T) {
+	ctx := tst.Go(t)
+	auth := srpc.AuthenticatorFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		user := r.Header.Get("X-User")
+		switch user {
+		case "":
+			return nil, errors.New("no user")
+		case "banned":
+			return nil, srpc.Forbidden("banned")
+		}
+		return context.WithValue(ctx, userKey{}, user), nil
+	})
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithAuthenticator(auth))
+	whoami := func(ctx context.Context, _ Req) (Resp, error) {
+		user, _ := ctx.Value(userKey{}).(string)
+		return Resp{user}, nil
+	}
+	private := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/private")
+	private.Register(srv, whoami)
+	public := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/public")
+	public.Register(srv, whoami, srpc.WithAuthenticator(srpc.AuthenticatorFunc(
+		func(ctx context.Context, _ *http.Request) (context.Context, error) {
+			return context.WithValue(ctx, userKey{}, "anonymous"), nil
+		},
+	)))
+
+	call := func(ep srpc.Endpoint[Resp, Req], user string) (Resp, error) {
+		conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user != "" {
+				r.Header.Set("X-User", user)
+			}
+			mux.ServeHTTP(w, r)
+		})))(t)
+		return ep.Remote(conn)(ctx, Req{})
+	}
+
+	t.Run("Identity", func(t *testing.T) {
+		got := tst.Do(call(private, "alice"))(t)
+		tst.Is(Resp{"alice"}, got, t)
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, err := call(private, "")
+		tst.Is(true, srpc.IsUnauthorized(err), t)
+	})
+
+	t.Run("CustomStatus", func(t *testing.T) {
+		_, err := call(private, "banned")
+		tst.Is(true, srpc.IsForbidden(err), t)
+	})
+
+	t.Run("PerEndpoint", func(t *testing.T) {
+		got := tst.Do(call(public, ""))(t)
+		tst.Is(Resp{"anonymous"}, got, t)
+	})
+}
+
+func TestServerClose(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux)
+	ep := srpc.NewEndpointSeq[SeqResp, Req]("/forever")
+	ep.Register(srv, func(ctx context.Context, req Req) (iter.Seq2[SeqResp, error], error) {
+		return func(yield func(SeqResp, error) bool) {
+			for i := 0; ; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+				if !yield(SeqResp{i}, nil) {
+					return
+				}
+			}
+		}, nil
+	})
+	c := ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))
+
+	seq := tst.Do(c(ctx, Req{}))(t)
+	n := 0
+	for _, err := range seq {
+		tst.No(err, t)
+		n++
+		if n == 3 {
+			srv.Close()
+		}
+	}
+	tst.Is(true, n >= 3, t)
+
+	_, err := c(ctx, Req{})
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusServiceUnavailable, werr.Code, t)
+}
+
+func TestStrictContentType(t *testing.T) {
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/strict")
+	proc := func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil }
+
+	tcs := []struct {
+		name   string
+		strict bool
+		ct     string
+		want   int
+	}{
+		{name: "Lenient", ct: "text/html", want: http.StatusOK},
+		{name: "Match", strict: true, ct: "application/json", want: http.StatusOK},
+		{name: "Params", strict: true, ct: "application/json; charset=utf-8", want: http.StatusOK},
+		{name: "Mismatch", strict: true, ct: "text/html", want: http.StatusUnsupportedMediaType},
+		{name: "Missing", strict: true, ct: "", want: http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			var opts []srpc.ServerOption
+			if tc.strict {
+				opts = append(opts, srpc.WithStrictContentType())
+			}
+			ep.Register(mux, proc, opts...)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(tst.Go(t), http.MethodPost, "/strict", strings.NewReader(`{"B":"x"}`))
+			req.Header.Set("Content-Type", tc.ct)
+			mux.ServeHTTP(rec, req)
+			tst.Is(tc.want, rec.Code, t)
+		})
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithMethodOverride())
+	methods := []string{http.MethodPut, http.MethodDelete, http.MethodPost}
+	var eps []srpc.Endpoint[Resp, Req]
+	for _, m := range methods {
+		ep := srpc.NewEndpointJSON[Resp, Req](m, "/items/{id}")
+		ep.Register(srv, func(ctx context.Context, req Req) (Resp, error) {
+			return Resp{m + " " + srpc.PathValue(ctx, "id") + srpc.HeaderFromContext(ctx, srpc.MethodOverrideHeader)}, nil
+		}, srpc.WithHeadersInContext(srpc.MethodOverrideHeader))
+		eps = append(eps, ep)
+	}
+
+	var sent []string
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method)
+		mux.ServeHTTP(w, r)
+	}), srpc.WithClientMethodOverride()))(t)
+	ctx = srpc.WithPathValue(ctx, "id", "7")
+	for i := range eps {
+		got := tst.Do(eps[i].Remote(conn)(ctx, Req{}))(t)
+		tst.Is(Resp{methods[i] + " 7"}, got, t)
+	}
+	tst.Is([]string{http.MethodPost, http.MethodPost, http.MethodPost}, sent, t)
+
+	t.Run("Direct", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+		got := tst.Do(eps[0].Remote(conn)(ctx, Req{}))(t)
+		tst.Is(Resp{"PUT 7"}, got, t)
+	})
+}
+
+func TestEndpoints(t *testing.T) {
+	tst.Go(t)
+	srv := srpc.NewServer(http.NewServeMux())
+	Ep.Register(srv, func(ctx context.Context, req Req) (Resp, error) { return Resp{}, nil })
+	n := srpc.NewEndpointN(http.MethodDelete, "/items/{id}")
+	n.Register(srv, func(ctx context.Context) error { return nil })
+
+	got := srv.Endpoints()
+	tst.Is(2, len(got), t)
+	tst.Is(http.MethodPost, got[0].Method, t)
+	tst.Is("/foo", got[0].Path, t)
+	tst.Is(true, got[0].Request == reflect.TypeFor[Req](), t)
+	tst.Is(true, got[0].Response == reflect.TypeFor[Resp](), t)
+	tst.Is("application/json", got[0].ResponseContentType, t)
+	tst.Is("/items/{id}", got[1].Path, t)
+	tst.Is(true, got[1].Response == reflect.TypeFor[struct{}](), t)
+}
+
+func TestRegisterNotFound(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/api/known")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{"known"}, nil })
+	srpc.RegisterNotFound(mux, "/api")
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"known"}, got, t)
+
+	unknown := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/api/unknown")
+	_, err := unknown.Remote(conn)(ctx, Req{})
+	tst.Is(true, srpc.IsNotFound(err), t)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is("Endpoint not found.", werr.Msg, t)
+	tst.Is(true, errors.Is(err, srpc.ErrEndpointNotFound), t)
+
+	// Paths that have endpoints with other methods are not found with 405.
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/known", nil))
+	tst.Is(http.StatusMethodNotAllowed, rec.Code, t)
+	tst.Is("POST", rec.Header().Get("Allow"), t)
+}
+
+func TestEndpointNotFound(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/users")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{}, srpc.NotFound("no such user")
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	_, err := ep.Remote(conn)(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrNotFound), t)
+	tst.Is(false, errors.Is(err, srpc.ErrEndpointNotFound), t)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusNotFound, werr.Code, t)
+	tst.Is("no such user", werr.Msg, t)
+
+	missing := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/missing")
+	_, err = missing.Remote(conn)(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrNotFound), t)
+	tst.Is(true, errors.Is(err, srpc.ErrEndpointNotFound), t)
+	werr = tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusNotFound, werr.Code, t)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithMethodNotAllowed())
+	get := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/items/{id}")
+	get.Register(srv, func(ctx context.Context, req Req) (Resp, error) { return Resp{"got"}, nil })
+	put := srpc.NewEndpointJSON[Resp, Req](http.MethodPut, "/items/{id}")
+	put.Register(srv, func(ctx context.Context, req Req) (Resp, error) { return Resp{"put"}, nil })
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	got := tst.Do(put.Remote(conn)(srpc.WithPathValue(ctx, "id", "1"), Req{}))(t)
+	tst.Is(Resp{"put"}, got, t)
+
+	del := srpc.NewEndpointJSON[Resp, Req](http.MethodDelete, "/items/{id}")
+	_, err := del.Remote(conn)(srpc.WithPathValue(ctx, "id", "1"), Req{})
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusMethodNotAllowed, werr.Code, t)
+	tst.Is("Method not allowed.", werr.Msg, t)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, "/items/1", nil))
+	tst.Is(http.StatusMethodNotAllowed, rec.Code, t)
+	tst.Is("GET, HEAD, PUT", rec.Header().Get("Allow"), t)
+}
+
+func TestTrailingSlash(t *testing.T) {
+	ctx := tst.Go(t)
+	register := func(redirect bool) *http.ServeMux {
+		mux := http.NewServeMux()
+		for _, path := range []string{"/foo", "/bar/", "/items/{id}", "/files/{path...}"} {
+			ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, path)
+			ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+				return Resp{path}, nil
+			}, srpc.WithTrailingSlash(redirect))
+		}
+		return mux
+	}
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/foo", http.StatusOK, ""},
+		{"/foo/", http.StatusPermanentRedirect, "/foo"},
+		{"/bar", http.StatusPermanentRedirect, "/bar/"},
+		{"/items/1/?x=1", http.StatusPermanentRedirect, "/items/1?x=1"},
+		{"/files/a/b/", http.StatusOK, ""},
+	}
+	for _, redirect := range []bool{false, true} {
+		mux := register(redirect)
+		for _, tt := range tests {
+			t.Run(fmt.Sprint(redirect, tt.path), func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, tt.path, strings.NewReader("{}")))
+				if !redirect {
+					tst.Is(http.StatusOK, rec.Code, t)
+					return
+				}
+				tst.Is(tt.status, rec.Code, t)
+				tst.Is(tt.location, rec.Header().Get("Location"), t)
+			})
+		}
+	}
+}
+
+// logRecorder is a [slog.Handler] that keeps the records it handles.
+type logRecorder struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (h *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *logRecorder) WithGroup(string) slog.Handler            { return h }
+
+func (h *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+// attrs returns the attributes of the records with the given message and endpoint.
+func (h *logRecorder) attrs(msg, endpoint string) []map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var got []map[string]string
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		m := map[string]string{}
+		r.Attrs(func(a slog.Attr) bool {
+			m[a.Key] = a.Value.String()
+			return true
+		})
+		if m["endpoint"] == endpoint {
+			got = append(got, m)
+		}
+	}
+	return got
+}
+
+func TestCodecContext(t *testing.T) {
+	ctx := tst.Go(t)
+	type tenantKey struct{}
+	auth := srpc.AuthenticatorFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		return context.WithValue(ctx, userKey{}, r.Header.Get("X-User")), nil
+	})
+	resc := srpc.NewCodecJSON[Resp]()
+	co := resc.Co
+	resc.Co = func(ctx context.Context, r Resp) (io.Reader, error) {
+		user, _ := ctx.Value(userKey{}).(string)
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		if user != "admin" {
+			r.A = "***"
+		}
+		return co(ctx, Resp{tenant + ":" + r.A})
+	}
+	ep := srpc.NewEndpoint(http.MethodPost, "/masked", resc, srpc.NewCodecJSON[Req]())
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{"secret"}, nil
+	}, srpc.WithAuthenticator(auth))
+
+	for _, user := range []string{"admin", "guest"} {
+		conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-User", user)
+			mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, "acme")))
+		})))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+		want := map[string]Resp{"admin": {"acme:secret"}, "guest": {"acme:***"}}[user]
+		tst.Is(want, got, t)
+	}
+}
+
+func TestBodyLogging(t *testing.T) {
+	ctx := tst.Go(t)
+	var logs logRecorder
+	prev := slog.Default()
+	slog.SetDefault(slog.New(&logs))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	type Login struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Login](http.MethodPost, "/login")
+	ep.Register(mux, func(ctx context.Context, req Login) (Resp, error) {
+		return Resp{"welcome " + req.User}, nil
+	}, srpc.WithBodyLogging(srpc.RedactJSONFields("password")))
+
+	got := tst.Do(ep.Remote(tst.Do(srpc.NewInMemoryTransport(mux))(t))(ctx, Login{"alice", "hunter2"}))(t)
+	tst.Is(Resp{"welcome alice"}, got, t)
+	tst.Is([]map[string]string{{
+		"endpoint": "POST /login",
+		"request":  `{"password":"[REDACTED]","user":"alice"}`,
+		"response": `{"A":"welcome alice"}`,
+	}}, logs.attrs("Bodies", "POST /login"), t)
+}
+
+func TestAccessLog(t *testing.T) {
+	ctx := tst.Go(t)
+	var logs logRecorder
+	prev := slog.Default()
+	slog.SetDefault(slog.New(&logs))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	mux := http.NewServeMux()
+	var gotID string
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		gotID = srpc.RequestIDFromContext(ctx)
+		if req.B == "" {
+			return Resp{}, srpc.BadRequest("Missing B.")
+		}
+		return Resp{req.B}, nil
+	}, srpc.WithAccessLog())
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	tst.Do(Ep.Remote(conn)(srpc.WithCallHeader(ctx, srpc.RequestIDHeader, "req-1"), Req{"x"}))(t)
+	_, err := Ep.Remote(conn)(ctx, Req{})
+	tst.Is(true, err != nil, t)
+
+	got := logs.attrs("Access", "POST /foo")
+	tst.Is(2, len(got), t)
+	tst.Is("req-1", got[0]["request_id"], t)
+	tst.Is("200", got[0]["status"], t)
+	tst.Is("9", got[0]["bytes_out"], t)
+	tst.Is("400", got[1]["status"], t)
+	tst.Is(gotID, got[1]["request_id"], t)
+	tst.Is(true, gotID != "" && gotID != "req-1", t)
+	tst.Is("POST", got[1]["method"], t)
+}
+
+func TestAuditor(t *testing.T) {
+	ctx := tst.Go(t)
+	var audited []string
+	auditor := srpc.AuditorFunc(func(ctx context.Context, r *http.Request, body []byte) error {
+		if string(body) == `{"B":"unaudited"}` {
+			return &srpc.WireError{Code: http.StatusServiceUnavailable, Msg: "Audit store unavailable."}
+		}
+		audited = append(audited, r.Method+" "+string(body))
+		return nil
+	})
+	var called int
+	proc := func(ctx context.Context, req Req) (Resp, error) {
+		called++
+		return Resp{req.B}, nil
+	}
+	mux := http.NewServeMux()
+	get := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/audited")
+	get.Register(mux, proc, srpc.WithAuditor(auditor))
+	Ep.Register(mux, proc, srpc.WithAuditor(auditor))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	tst.Do(Ep.Remote(conn)(ctx, Req{"body"}))(t)
+	tst.Do(get.Remote(conn)(ctx, Req{"query"}))(t)
+	tst.Is([]string{`POST {"B":"body"}`, `GET {"B":"query"}`}, audited, t)
+
+	_, err := Ep.Remote(conn)(ctx, Req{"unaudited"})
+	tst.Err("Audit store unavailable.", err, t)
+	tst.Is(2, called, t)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	ctx := tst.Go(t)
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/limited")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		return Resp{req.B}, nil
+	}, srpc.WithConcurrencyLimit(1, 0))
+	queued := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/queued")
+	queued.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		return Resp{req.B}, nil
+	}, srpc.WithConcurrencyLimit(1, time.Minute))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	// Requests over the limit are rejected.
+	done := make(chan error)
+	go func() {
+		_, err := ep.Remote(conn)(ctx, Req{"slow"})
+		done <- err
+	}()
+	<-started
+	_, err := ep.Remote(conn)(ctx, Req{"fast"})
+	tst.Is(true, errors.Is(err, srpc.ErrServiceUnavailable), t)
+	release <- struct{}{}
+	tst.No(<-done, t)
+	tst.Do(ep.Remote(conn)(ctx, Req{"fast"}))(t)
+
+	// Requests over the limit wait in the queue.
+	go func() {
+		_, err := queued.Remote(conn)(ctx, Req{"slow"})
+		done <- err
+	}()
+	<-started
+	fast := make(chan Resp)
+	go func() {
+		resp, _ := queued.Remote(conn)(ctx, Req{"fast"})
+		fast <- resp
+	}()
+	release <- struct{}{}
+	tst.No(<-done, t)
+	tst.Is(Resp{"fast"}, <-fast, t)
+}
+
+func TestCookies(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	login := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/login")
+	login.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		srpc.SetCookie(ctx, &http.Cookie{Name: "session", Value: req.B, Path: "/", HttpOnly: true, MaxAge: 3600})
+		return Resp{"welcome"}, nil
+	})
+	whoami := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/whoami")
+	whoami.Register(mux, func(ctx context.Context, _ Req) (Resp, error) {
+		c, err := srpc.RequestCookie(ctx, "session")
+		if err != nil {
+			return Resp{}, srpc.Unauthorized("no session")
+		}
+		return Resp{c.Value}, nil
+	})
+	logout := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/logout")
+	logout.Register(mux, func(ctx context.Context, _ Req) (Resp, error) {
+		srpc.SetCookie(ctx, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+		return Resp{"bye"}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), []*http.Cookie{{Name: "theme", Value: "dark"}},
+		srpc.WithCookieCapture()))(t)
+	_, err := whoami.Remote(conn)(ctx, Req{})
+	tst.Is(true, srpc.IsUnauthorized(err), t)
+
+	var info srpc.ResponseInfo
+	tst.Do(login.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{"alice"}))(t)
+	tst.Is("session=alice; Path=/; Max-Age=3600; HttpOnly", info.Header.Get("Set-Cookie"), t)
+	tst.Is(Resp{"alice"}, tst.Do(whoami.Remote(conn)(ctx, Req{}))(t), t)
+
+	tst.Do(logout.Remote(conn)(ctx, Req{}))(t)
+	_, err = whoami.Remote(conn)(ctx, Req{})
+	tst.Is(true, srpc.IsUnauthorized(err), t)
+
+	// Without capture cookies set by responses are not sent back.
+	conn = tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t)
+	tst.Do(login.Remote(conn)(ctx, Req{"bob"}))(t)
+	_, err = whoami.Remote(conn)(ctx, Req{})
+	tst.Is(true, srpc.IsUnauthorized(err), t)
+}
+
+func TestCookieJar(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	login := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/jar/login")
+	login.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		srpc.SetCookie(ctx, &http.Cookie{Name: "session", Value: req.B, Path: "/jar"})
+		return Resp{}, nil
+	})
+	whoami := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/jar/whoami")
+	whoami.Register(mux, func(ctx context.Context, _ Req) (Resp, error) {
+		c, err := srpc.RequestCookie(ctx, "session")
+		if err != nil {
+			return Resp{}, srpc.Unauthorized("no session")
+		}
+		return Resp{c.Value}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil, srpc.WithCookieJar(nil)))(t)
+	tenant := conn.Clone(srpc.WithCookieJar(nil))
+	tst.Do(login.Remote(conn)(ctx, Req{"alice"}))(t)
+	tst.Is(Resp{"alice"}, tst.Do(whoami.Remote(conn)(ctx, Req{}))(t), t)
+	tst.Is(Resp{"alice"}, tst.Do(whoami.Remote(conn.Clone())(ctx, Req{}))(t), t)
+
+	// Clones with their own jar don't share the session.
+	_, err := whoami.Remote(tenant)(ctx, Req{})
+	tst.Is(true, srpc.IsUnauthorized(err), t)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/panic")
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "bug" {
+			panic("secret details")
+		}
+		return Resp{}, srpc.BadRequest("bad")
+	}, srpc.WithPanicRecovery())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t)
+
+	_, err := ep.Remote(conn)(ctx, Req{"bug"})
+	tst.Is(true, errors.Is(err, srpc.ErrServerPanic), t)
+	tst.Is(true, errors.Is(err, srpc.ErrInternal), t)
+	tst.Is(false, strings.Contains(err.Error(), "secret"), t)
+
+	_, err = ep.Remote(conn)(ctx, Req{"input"})
+	tst.Is(true, errors.Is(err, srpc.ErrBadRequest), t)
+	tst.Is(false, errors.Is(err, srpc.ErrServerPanic), t)
+}
+
+func TestCookiePrecedence(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/echo-cookies")
+	ep.Register(mux, func(ctx context.Context, _ Req) (Resp, error) {
+		return Resp{srpc.HeaderFromContext(ctx, "Cookie") + "|" + srpc.HeaderFromContext(ctx, "X-Env")}, nil
+	}, srpc.WithHeadersInContext("Cookie", "X-Env"))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	conn = conn.Clone(
+		srpc.WithCookies(&http.Cookie{Name: "a", Value: "transport"}, &http.Cookie{Name: "b", Value: "transport"},
+			&http.Cookie{Name: "c", Value: "transport"}),
+		srpc.WithHeaders(http.Header{"Cookie": {"b=header"}, "X-Env": {"prod"}}))
+
+	got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"a=transport; b=header; c=transport|prod"}, got, t)
+
+	cctx := srpc.WithCallCookie(ctx, &http.Cookie{Name: "c", Value: "call"})
+	cctx = srpc.WithCallCookie(cctx, &http.Cookie{Name: "d", Value: "call"})
+	cctx = srpc.WithCallHeader(cctx, "X-Env", "staging")
+	got = tst.Do(ep.Remote(conn)(cctx, Req{}))(t)
+	tst.Is(Resp{"a=transport; b=header; c=call; d=call|staging"}, got, t)
+}
+
+func TestClientIP(t *testing.T) {
+	tst.Go(t)
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+	tcs := []struct {
+		name   string
+		remote string
+		trust  string
+		header http.Header
+		want   string
+	}{
+		{name: "Direct", remote: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "Untrusted proxy", remote: "203.0.113.7:1234", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "203.0.113.7"},
+		{name: "Trusted proxy", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "Spoofed", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.2"}}, want: "198.51.100.1"},
+		{name: "Multiple headers", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"198.51.100.1", "10.0.0.2"}}, want: "198.51.100.1"},
+		{name: "All trusted", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, want: "10.0.0.3"},
+		{
+			name: "Forwarded", remote: "[fd00::1]:1234", trust: "Forwarded",
+			header: http.Header{"Forwarded": {`for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711";by=fd00::1`}},
+			want:   "2001:db8:cafe::17",
+		},
+		{
+			name: "Other header ignored", remote: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"198.51.100.1"}},
+			want:   "198.51.100.1",
+		},
+		{
+			name: "Missing header", remote: "10.0.0.1:1234", trust: "Forwarded",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:   "10.0.0.1",
+		},
+		{name: "Obfuscated", remote: "10.0.0.1:1234", trust: "forwarded", header: http.Header{"Forwarded": {"for=_hidden, for=10.0.0.2"}}, want: "10.0.0.2"},
+		{name: "Mapped", remote: "[::ffff:10.0.0.1]:1234", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "Unix socket", remote: "@", want: "invalid IP"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			trust := tc.trust
+			if trust == "" {
+				trust = "X-Forwarded-For"
+			}
+			r := &http.Request{RemoteAddr: tc.remote, Header: tc.header}
+			tst.Is(tc.want, srpc.ClientIP(r, trust, trusted).String(), t)
+		})
+	}
+}
+
+func TestClientIPFromContext(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.ClientIPFromContext(ctx).String()}, nil
+	}, srpc.WithTrustedProxies("X-Forwarded-For", netip.MustParsePrefix("127.0.0.0/8")))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithHeaders(http.Header{"X-Forwarded-For": {"198.51.100.1"}})))(t)
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"198.51.100.1"}, got, t)
+}
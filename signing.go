@@ -0,0 +1,176 @@
+package srpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set by [HMACSigner] and checked by [HMACVerifier].
+const (
+	SignatureHeader = "Srpc-Signature"
+	TimestampHeader = "Srpc-Timestamp"
+)
+
+// Signer returns the headers that authenticate a request with the given method, path,
+// including the query, and body.
+type Signer func(ctx context.Context, method, path string, body []byte) (http.Header, error)
+
+// WithSigner makes the transport sign every request with s.
+//
+// Signing requires the whole body, so requests are buffered in memory instead of being
+// streamed to the server. Retried requests are signed again.
+//
+// Requests are signed after all other options have prepared them, regardless of the order
+// of the options. Requests tunneled through POST by [WithClientMethodOverride] are signed with
+// their real method, which is the one verified by servers created with [WithMethodOverride].
+func WithSigner(s Signer) TransportOption {
+	return func(t *Transport) { t.signer = s }
+}
+
+// prepareHooks returns the prepare hooks of t followed by the one that signs requests, if any,
+// so that signatures cover the final request.
+func (t *Transport) prepareHooks() []func(context.Context, *http.Request) error {
+	if t.signer == nil {
+		return t.prepare
+	}
+	return append(slices.Clip(t.prepare), func(ctx context.Context, r *http.Request) error {
+		return signRequest(ctx, t.signer, r)
+	})
+}
+
+// signRequest adds the headers returned by s to r.
+func signRequest(ctx context.Context, s Signer, r *http.Request) error {
+	body, err := bufferBody(r, 0)
+	if err != nil {
+		return fmt.Errorf("signing: %w", err)
+	}
+	method := r.Method
+	if m := r.Header.Get(MethodOverrideHeader); m != "" && method == http.MethodPost {
+		method = strings.ToUpper(m)
+	}
+	h, err := s(ctx, method, r.URL.RequestURI(), body)
+	if err != nil {
+		return fmt.Errorf("signing: %w", err)
+	}
+	for k, v := range h {
+		r.Header[k] = v
+	}
+	return nil
+}
+
+// Verifier checks the signature of requests before they are decoded.
+type Verifier interface {
+	// Verify returns an error if r, with the given body, is not signed correctly.
+	//
+	// If it returns an error the request is rejected with the error status if it implements
+	// [ErrorResponse], or with 401 Unauthorized otherwise.
+	Verify(ctx context.Context, r *http.Request, body []byte) error
+}
+
+// VerifierFunc is an adapter to use ordinary functions as [Verifier].
+type VerifierFunc func(ctx context.Context, r *http.Request, body []byte) error
+
+// Verify implements [Verifier].
+func (f VerifierFunc) Verify(ctx context.Context, r *http.Request, body []byte) error {
+	return f(ctx, r, body)
+}
+
+// WithVerifier makes endpoints verify the signature of requests with v, before authenticating them.
+//
+// Verification requires the whole body, so requests are buffered in memory before being decoded.
+// Bodies are limited to the size set by [WithMaxRequestBytes], or to 10 MiB if it is not set,
+// and larger requests are rejected with 413 Request Entity Too Large.
+func WithVerifier(v Verifier) ServerOption {
+	return func(c *serverConfig) {
+		c.verifier = v
+	}
+}
+
+// bufferBody reads the whole body of r and replaces it with an in-memory copy.
+//
+// If limit is positive, bodies larger than limit bytes make it fail with a [*http.MaxBytesError].
+func bufferBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	var src io.Reader = r.Body
+	if limit > 0 {
+		src = io.LimitReader(r.Body, limit+1)
+	}
+	body, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		_ = r.Body.Close()
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	if err := r.Body.Close(); err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, nil
+}
+
+// hmacSignature computes the signature of a request with key.
+func hmacSignature(key []byte, timestamp, method, path string, body []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	_, _ = io.WriteString(m, timestamp+"\n"+method+"\n"+path+"\n")
+	_, _ = m.Write(body)
+	return m.Sum(nil)
+}
+
+// HMACSigner returns a [Signer] that signs requests with HMAC-SHA256 using key.
+//
+// The signature covers the current Unix time, the method, the path and the body,
+// and is sent hex-encoded in the [SignatureHeader], while the time is sent in the [TimestampHeader].
+func HMACSigner(key []byte) Signer {
+	return func(_ context.Context, method, path string, body []byte) (http.Header, error) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		return http.Header{
+			SignatureHeader: {hex.EncodeToString(hmacSignature(key, ts, method, path, body))},
+			TimestampHeader: {ts},
+		}, nil
+	}
+}
+
+// ErrBadSignature is returned by [HMACVerifier] for requests that are not signed correctly.
+var ErrBadSignature = errors.New("bad request signature")
+
+// HMACVerifier returns a [Verifier] that checks requests signed by [HMACSigner] with key.
+//
+// Requests whose timestamp differs from the current time by more than maxSkew are rejected,
+// to limit replays.
+func HMACVerifier(key []byte, maxSkew time.Duration) Verifier {
+	return VerifierFunc(func(_ context.Context, r *http.Request, body []byte) error {
+		ts := r.Header.Get(TimestampHeader)
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid timestamp %q", ErrBadSignature, ts)
+		}
+		if d := time.Since(time.Unix(sec, 0)); d > maxSkew || d < -maxSkew {
+			return fmt.Errorf("%w: timestamp too far from current time", ErrBadSignature)
+		}
+		got, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+		if err != nil {
+			return fmt.Errorf("%w: invalid encoding", ErrBadSignature)
+		}
+		if !hmac.Equal(got, hmacSignature(key, ts, r.Method, r.URL.RequestURI(), body)) {
+			return ErrBadSignature
+		}
+		return nil
+	})
+}
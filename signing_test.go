@@ -0,0 +1,72 @@
+package srpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/tst"
+)
+
+func TestHMACSigning(t *testing.T) {
+	ctx := tst.Go(t)
+	key := []byte("shared secret")
+	mux := http.NewServeMux()
+	opt := srpc.WithVerifier(srpc.HMACVerifier(key, time.Minute))
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil }, opt)
+	get := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/signed")
+	get.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil }, opt)
+
+	t.Run("Signed", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithSigner(srpc.HMACSigner(key))))(t)
+		got := tst.Do(Ep.Remote(conn)(ctx, Req{"body"}))(t)
+		tst.Is(Resp{"body"}, got, t)
+		got = tst.Do(get.Remote(conn)(ctx, Req{"query"}))(t)
+		tst.Is(Resp{"query"}, got, t)
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithSigner(srpc.HMACSigner([]byte("wrong")))))(t)
+		_, err := Ep.Remote(conn)(ctx, Req{"body"})
+		tst.Is(true, srpc.IsUnauthorized(err), t)
+	})
+	t.Run("Unsigned", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+		_, err := get.Remote(conn)(ctx, Req{"query"})
+		tst.Is(true, srpc.IsUnauthorized(err), t)
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		mux := http.NewServeMux()
+		Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil },
+			opt, srpc.WithMaxRequestBytes(16))
+		rec := httptest.NewRecorder()
+		// The body has no known length, so it is only limited while it is buffered.
+		body := io.MultiReader(strings.NewReader(`{"B":"` + strings.Repeat("a", 32) + `"}`))
+		mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, "/foo", body))
+		tst.Is(http.StatusRequestEntityTooLarge, rec.Code, t)
+	})
+}
+
+func TestHMACSigningMethodOverride(t *testing.T) {
+	ctx := tst.Go(t)
+	key := []byte("shared secret")
+	mux := http.NewServeMux()
+	srv := srpc.NewServer(mux, srpc.WithMethodOverride(), srpc.WithVerifier(srpc.HMACVerifier(key, time.Minute)))
+	put := srpc.NewEndpointJSON[Resp, Req](http.MethodPut, "/signed")
+	put.Register(srv, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil })
+
+	for name, opts := range map[string][]srpc.TransportOption{
+		"SignerFirst":   {srpc.WithSigner(srpc.HMACSigner(key)), srpc.WithClientMethodOverride()},
+		"OverrideFirst": {srpc.WithClientMethodOverride(), srpc.WithSigner(srpc.HMACSigner(key))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn := tst.Do(srpc.NewInMemoryTransport(mux, opts...))(t)
+			got := tst.Do(put.Remote(conn)(ctx, Req{"body"}))(t)
+			tst.Is(Resp{"body"}, got, t)
+		})
+	}
+}
@@ -2,8 +2,12 @@
 package srpc
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -11,7 +15,10 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 // QueryKey is the key for the query parameter that sRPC will use to issue state-preserving requests.
@@ -27,13 +34,78 @@ type Endpoint[Response, Request any] struct {
 	method        string
 	path          string
 	stateChanging bool
+	rawQuery      bool
 	resc          Codec[Response]
 	reqc          Codec[Request]
+	opts          endpointOptions
+}
+
+// endpointOptions are the settings of an endpoint that don't depend on its types.
+type endpointOptions struct {
+	// queryKey is the query parameter that carries requests sent in the URL.
+	queryKey string
+	// maxQueryLen is the length of the query above which requests are sent in the body, if positive.
+	maxQueryLen int
+	// clientValidation makes remote procedures validate requests before sending them.
+	clientValidation bool
+	// lenientContentType makes remote procedures decode responses regardless of their Content-Type.
+	lenientContentType bool
+	// allowEmptyResponse makes remote procedures return the zero value for empty 200 responses.
+	allowEmptyResponse bool
+}
+
+// EndpointOption configures optional behavior of an endpoint, on both the client and the server side.
+type EndpointOption func(*endpointOptions)
+
+// WithMaxQueryLen makes requests that are not state-changing use POST with the request in the body
+// when their query string would be longer than n bytes. This allows requests too large for a URL
+// to be sent to read-only endpoints.
+//
+// The server side accepts both forms, so it also handles POST requests on the endpoint path,
+// which must not be registered by other endpoints.
+func WithMaxQueryLen(n int) EndpointOption {
+	return func(o *endpointOptions) { o.maxQueryLen = n }
+}
+
+// WithQueryKey makes the endpoint send requests in the URL as the value of the key query parameter,
+// instead of [QueryKey].
+//
+// It has no effect on state-changing endpoints and on endpoints that map requests to query parameters.
+func WithQueryKey(key string) EndpointOption {
+	return func(o *endpointOptions) { o.queryKey = key }
+}
+
+// WithClientValidation makes remote procedures validate requests that implement [Validable] before sending them.
+//
+// Invalid requests are not sent: calls fail with the same 400 [WireError] the server would respond with.
+func WithClientValidation() EndpointOption {
+	return func(o *endpointOptions) { o.clientValidation = true }
+}
+
+// WithLenientContentType makes remote procedures decode responses regardless of their Content-Type,
+// instead of failing when it doesn't match the one of the response codec.
+//
+// It is meant for servers behind proxies that rewrite the Content-Type of responses.
+func WithLenientContentType() EndpointOption {
+	return func(o *endpointOptions) { o.lenientContentType = true }
+}
+
+// WithAllowEmptyResponse makes remote procedures return the zero value for 200 responses with an empty body,
+// which are sent by some servers when there is no result, instead of failing to decode them.
+//
+// Responses with other successful statuses, like 201 and 204, can always be empty.
+func WithAllowEmptyResponse() EndpointOption {
+	return func(o *endpointOptions) { o.allowEmptyResponse = true }
 }
 
 // NewEndpointJSON constructs an endpoint with the JSON codec.
-func NewEndpointJSON[Response, Request any](method, path string) Endpoint[Response, Request] {
-	return NewEndpoint(method, path, NewCodecJSON[Response](), NewCodecJSON[Request]())
+func NewEndpointJSON[Response, Request any](method, path string, opts ...EndpointOption) Endpoint[Response, Request] {
+	return NewEndpoint(method, path, NewCodecJSON[Response](), NewCodecJSON[Request](), opts...)
+}
+
+// NewEndpointXML constructs an endpoint with the XML codec.
+func NewEndpointXML[Response, Request any](method, path string, opts ...EndpointOption) Endpoint[Response, Request] {
+	return NewEndpoint(method, path, NewCodecXML[Response](), NewCodecXML[Request](), opts...)
 }
 
 // NewEndpointSeq constructs and endpoint with JSON request and Seq response.
@@ -42,21 +114,74 @@ func NewEndpointJSON[Response, Request any](method, path string) Endpoint[Respon
 //
 // The events are "val" and "err", based on what the Procedure passes to yield.
 // Yielding a value and an error at the same time is not supported.
-func NewEndpointSeq[Response, Request any](path string) Endpoint[iter.Seq2[Response, error], Request] {
-	return NewEndpoint(string(http.MethodGet), path, NewCodecSeq[Response](), NewCodecJSON[Request]())
+func NewEndpointSeq[Response, Request any](path string, opts ...EndpointOption) Endpoint[iter.Seq2[Response, error], Request] {
+	return NewEndpoint(string(http.MethodGet), path, NewCodecSeq[Response](), NewCodecJSON[Request](), opts...)
+}
+
+// NewEndpointReader constructs an endpoint with JSON request and a response that is
+// streamed verbatim with the given Content-Type.
+//
+// See [NewCodecReader] for details.
+func NewEndpointReader[Request any](method, path, contentType string, opts ...EndpointOption) Endpoint[io.ReadCloser, Request] {
+	return NewEndpoint(method, path, NewCodecReader(contentType), NewCodecJSON[Request](), opts...)
+}
+
+// NewEndpointRawBody constructs an endpoint with JSON response whose request body is
+// passed to procedures as a stream.
+//
+// See [NewCodecRawBody] for details.
+func NewEndpointRawBody[Response any](method, path, contentType string, bufSize int, opts ...EndpointOption) Endpoint[Response, *RawBody] {
+	return NewEndpoint(method, path, NewCodecJSON[Response](), NewCodecRawBody(contentType, bufSize), opts...)
+}
+
+// NewEndpointPayload constructs an endpoint with JSON request and a response whose Content-Type
+// is chosen by the procedure.
+//
+// See [NewCodecPayload] for details.
+func NewEndpointPayload[Request any](method, path string, opts ...EndpointOption) Endpoint[Payload, Request] {
+	return NewEndpoint(method, path, NewCodecPayload(), NewCodecJSON[Request](), opts...)
+}
+
+// NewEndpointQuery constructs a GET endpoint with JSON response whose request is
+// mapped to individual query parameters.
+//
+// See [NewCodecQuery] for how requests are mapped.
+func NewEndpointQuery[Response, Request any](path string, opts ...EndpointOption) Endpoint[Response, Request] {
+	return NewEndpoint(http.MethodGet, path, NewCodecJSON[Response](), NewCodecQuery[Request](), opts...)
 }
 
 // NewEndpoint constructs a new endpoint with the given codecs.
-func NewEndpoint[Response, Request any](method, path string, resc Codec[Response], reqc Codec[Request]) Endpoint[Response, Request] {
+//
+// It panics if method is not one of GET, POST, PUT, PATCH, DELETE, HEAD or OPTIONS,
+// or if path does not start with '/'.
+//
+// Requests to endpoints that are not state-changing (GET, HEAD and OPTIONS) are sent in the URL:
+// if the request codec produces "application/x-www-form-urlencoded" content it is used as the
+// query string, otherwise it is sent as the value of the [QueryKey] query parameter, see [WithQueryKey].
+// Requests to the other endpoints, including DELETE ones, are sent in the body, so that for example
+// a bulk delete can carry the IDs to delete.
+func NewEndpoint[Response, Request any](method, path string, resc Codec[Response], reqc Codec[Request], opts ...EndpointOption) Endpoint[Response, Request] {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions:
+	default:
+		panic(fmt.Sprintf("method must be a known HTTP method, %q provided", method))
+	}
 	if !strings.HasPrefix(path, "/") {
 		panic(fmt.Sprintf("path must start with '/', %q provided", path))
 	}
+	eo := endpointOptions{queryKey: QueryKey}
+	for _, o := range opts {
+		o(&eo)
+	}
 	return Endpoint[Response, Request]{
 		method:        method,
 		path:          path,
 		stateChanging: method != http.MethodGet && method != http.MethodOptions && method != http.MethodHead,
+		rawQuery:      reqc.ContentType == formContentType,
 		resc:          resc,
 		reqc:          reqc,
+		opts:          eo,
 	}
 }
 
@@ -71,7 +196,9 @@ type Mux interface {
 
 // Validable represents all requests that can be validated.
 //
-// All requests that implement this and that are not valid will be automatically rejected.
+// All requests that implement this and that are not valid will be automatically rejected,
+// with 400 Bad Request or, if the error is a [*ValidationError], with 422 Unprocessable Entity
+// and the invalid fields.
 //
 // IMPORTANT NOTE: the validation error is returned to the client, so it should be
 // telling enough for a user to understand what is wrong, but it should not contain
@@ -86,85 +213,407 @@ type ErrorResponse interface {
 	Message() string
 }
 
+// Alias returns an endpoint with the same codecs and options as e, reachable with a different method and path.
+//
+// It can be used to register the same procedure on several routes.
+// It panics under the same conditions as [NewEndpoint].
+func (e *Endpoint[Response, Request]) Alias(method, path string) Endpoint[Response, Request] {
+	a := NewEndpoint(method, path, e.resc, e.reqc)
+	a.opts = e.opts
+	return a
+}
+
 // Register registers the endpoint on the mux, implemented by the procedure.
-func (e *Endpoint[Response, Request]) Register(m Mux, p Procedure[Response, Request]) {
-	m.HandleFunc(e.method+" "+e.path, func(hResp http.ResponseWriter, hReq *http.Request) {
-		ctx := hReq.Context()
+//
+// If m is a [*Server] its options apply to the endpoint, opts are applied on top of them.
+//
+// Procedures whose response is encoded as nothing, like struct{} with the JSON codec,
+// are answered with 204 No Content and no Content-Type.
+//
+// If the response stream fails after the status was sent, the error is reported in the
+// Srpc-Status and Srpc-Message trailers, and clients return it from the last read of the body.
+func (e *Endpoint[Response, Request]) Register(m Mux, p Procedure[Response, Request], opts ...ServerOption) {
+	cfg := newServerConfig(m, opts)
+	if s, ok := m.(*Server); ok {
+		s.record(e.info())
+	}
+	h := e.handler(cfg, p)
+	methods := []string{e.method}
+	if e.opts.maxQueryLen > 0 && !e.stateChanging {
+		methods = append(methods, http.MethodPost)
+	}
+	variant, hasVariant := slashVariant(e.path)
+	for _, method := range methods {
+		m.HandleFunc(method+" "+e.path, h)
+		if cfg.trailingSlash && hasVariant {
+			m.HandleFunc(method+" "+variant, cfg.slashHandler(h))
+		}
+	}
+}
 
-		// Parse Request
+// Handler returns the handler that serves the endpoint with p, without registering it,
+// so that it can be mounted on any router or wrapped in middleware.
+//
+// The handler doesn't check the method and path of requests: routing them is up to the caller.
+// [PathValue] reads the wildcards matched by [http.ServeMux], other routers must set them
+// with [http.Request.SetPathValue].
+// Options that need a [Server], like [WithMethodOverride], or that register additional patterns,
+// like [WithTrailingSlash], have no effect.
+func (e *Endpoint[Response, Request]) Handler(p Procedure[Response, Request], opts ...ServerOption) http.HandlerFunc {
+	return e.handler(newServerConfig(nil, opts), p)
+}
 
-		var req Request
-		{
-			streamUp := hReq.Body
-			if !e.stateChanging {
-				streamUp = io.NopCloser(strings.NewReader(hReq.URL.Query().Get(QueryKey)))
+// handler returns the handler that serves the endpoint with p according to cfg.
+func (e *Endpoint[Response, Request]) handler(cfg serverConfig, p Procedure[Response, Request]) http.HandlerFunc {
+	sem := newSemaphore(cfg)
+	return func(hResp http.ResponseWriter, hReq *http.Request) {
+		start := time.Now()
+		w := &responseRecorder{ResponseWriter: hResp}
+		ev := ServerEvent{Method: e.method, Path: e.path}
+		ctx := hReq.Context()
+		var requestID string
+		if cfg.accessLog {
+			ctx, requestID = withRequestID(ctx, hReq, hResp.Header())
+		}
+		defer func() {
+			ev.Status = w.statusCode()
+			ev.Duration = time.Since(start)
+			cfg.metrics.RequestServed(hReq.Context(), ev)
+			if cfg.accessLog {
+				logAccess(hReq.Context(), hReq, requestID, ClientIP(hReq, cfg.forwardedHeader, cfg.trustedProxies), ev)
 			}
+		}()
+		if cfg.recoverPanics {
+			defer recoverPanic(hReq.Context(), w)
+		}
 
-			var err error
-			req, err = e.reqc.Dec(ctx, streamUp)
-			if err != nil {
+		if cfg.lifecycle.Err() != nil {
+			http.Error(w, "Server is shutting down.", http.StatusServiceUnavailable)
+			return
+		}
+		if !sem.acquire(ctx) {
+			http.Error(w, "Too many concurrent requests.", http.StatusServiceUnavailable)
+			return
+		}
+		defer sem.release()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(cfg.lifecycle, cancel)()
+		ctx, cancelTimeout := withPropagatedTimeout(ctx, hReq, cfg.maxTimeout)
+		defer cancelTimeout()
+
+		ctx = context.WithValue(ctx, requestKey{}, hReq)
+		ctx = context.WithValue(ctx, patternKey{}, e.method+" "+e.path)
+		ctx = context.WithValue(ctx, clientIPKey{}, ClientIP(hReq, cfg.forwardedHeader, cfg.trustedProxies))
+		ctx = withRequestHeaders(ctx, hReq, cfg.ctxHeaders)
+		ctx = extract(ctx, hReq.Header, cfg.propagators)
+		ctx = context.WithValue(ctx, responseHeaderKey{}, hResp.Header())
+		ctx = context.WithValue(ctx, earlyHintsKey{}, func() { w.WriteHeader(http.StatusEarlyHints) })
+		ctx = context.WithValue(ctx, statusKey{}, new(int))
+		ctx, cleanup := withCleanups(ctx)
+		defer cleanup()
+		e.serve(ctx, cfg, w, hReq, p, &ev)
+	}
+}
+
+// serve handles a single request to the endpoint.
+func (e *Endpoint[Response, Request]) serve(
+	ctx context.Context, cfg serverConfig, hResp http.ResponseWriter, hReq *http.Request, p Procedure[Response, Request], ev *ServerEvent,
+) {
+	var reqBody, respBody *capBuffer
+	if cfg.logBodies {
+		reqBody, respBody = &capBuffer{}, &capBuffer{}
+		defer func() {
+			slog.LogAttrs(ctx, slog.LevelDebug, "Bodies",
+				slog.String("endpoint", e.method+" "+e.path),
+				slog.String("request", reqBody.logged(hReq.Header.Get("Content-Type"), cfg.redact)),
+				slog.String("response", respBody.logged(hResp.Header().Get("Content-Type"), cfg.redact)))
+		}()
+	}
+
+	// Checks that don't read the body come first, so that clients that sent Expect: 100-continue
+	// don't send it if the request is going to be rejected.
+
+	if cfg.maxRequestBytes > 0 {
+		if hReq.ContentLength > cfg.maxRequestBytes {
+			http.Error(hResp, "Request too large.", http.StatusRequestEntityTooLarge)
+			return
+		}
+		hReq.Body = http.MaxBytesReader(hResp, hReq.Body, cfg.maxRequestBytes)
+	}
+	if ct := hReq.Header.Get("Content-Type"); cfg.strictContentType && e.stateChanging &&
+		e.reqc.ContentType != "" && (ct == "" || !sameMediaType(ct, e.reqc.ContentType)) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "Unsupported media type",
+			slog.String("error", fmt.Sprintf("Content-Type: want %q got %q", e.reqc.ContentType, ct)))
+		http.Error(hResp, "Unsupported media type.", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Authenticate
+
+	if verified, _ := ctx.Value(verifiedKey{}).(bool); cfg.verifier != nil && !verified {
+		body, ok := bufferRequest(cfg, hResp, hReq)
+		if !ok {
+			return
+		}
+		if err := cfg.verifier.Verify(ctx, hReq, body); err != nil {
+			status, msg := errorStatus(err, http.StatusUnauthorized)
+			slog.LogAttrs(ctx, slog.LevelInfo, "Unverified",
+				slog.String("error", fmt.Sprintf("verifying: %s", err)))
+			http.Error(hResp, msg, status)
+			return
+		}
+	}
+	if cfg.auth != nil {
+		actx, err := cfg.auth.Authenticate(ctx, hReq)
+		if err != nil {
+			status, msg := errorStatus(err, http.StatusUnauthorized)
+			slog.LogAttrs(ctx, slog.LevelInfo, "Unauthenticated",
+				slog.String("error", fmt.Sprintf("authenticating: %s", err)))
+			http.Error(hResp, msg, status)
+			return
+		}
+		ctx = actx
+	}
+	if key := hReq.Header.Get(IdempotencyKeyHeader); cfg.idempotency != nil && key != "" && !idempotent(e.method) {
+		body, ok := bufferRequest(cfg, hResp, hReq)
+		if !ok {
+			return
+		}
+		iw, ok := reserveIdempotent(ctx, cfg, e.method+" "+e.path+" "+key, requestHash(hReq, body), hResp, hReq)
+		if !ok {
+			return
+		}
+		defer iw.finish(ctx)
+		hResp = iw
+	}
+
+	// Parse Request
+
+	var req Request
+	{
+		streamUp := hReq.Body
+		streamedInURL := false
+		switch {
+		case e.stateChanging, hReq.Method == http.MethodPost:
+		case e.rawQuery:
+			streamUp = io.NopCloser(strings.NewReader(hReq.URL.RawQuery))
+		default:
+			streamUp = io.NopCloser(strings.NewReader(hReq.URL.Query().Get(e.opts.queryKey)))
+			streamedInURL = true
+		}
+		cr := &countingReader{ReadCloser: streamUp}
+		defer func() { ev.BytesIn = cr.n.Load() }()
+		streamUp = cr
+		if len(cfg.requestEncodings) > 0 && !e.reqc.KeepOpen && (e.stateChanging || hReq.Method == http.MethodPost) {
+			dr, ok, err := decompressRequest(streamUp, hReq.Header.Get("Content-Encoding"), cfg.requestEncodings)
+			switch {
+			case !ok:
+				slog.LogAttrs(ctx, slog.LevelInfo, "Unsupported media type",
+					slog.String("error", fmt.Sprintf("Content-Encoding: %q", hReq.Header.Get("Content-Encoding"))))
+				http.Error(hResp, "Unsupported content encoding.", http.StatusUnsupportedMediaType)
+				return
+			case err != nil:
 				slog.LogAttrs(ctx, slog.LevelInfo, "Bad request",
-					slog.String("error", fmt.Sprintf("decoding: %s", err)))
+					slog.String("error", err.Error()))
 				http.Error(hResp, "Unable to decode request.", http.StatusBadRequest)
 				return
 			}
+			streamUp = dr
+			if cfg.maxDecompressedBytes > 0 {
+				streamUp = http.MaxBytesReader(hResp, dr, cfg.maxDecompressedBytes)
+			}
+		}
+		if reqBody != nil {
+			streamUp = &teeReader{ReadCloser: streamUp, buf: reqBody}
+		}
+		var audited bytes.Buffer
+		if cfg.auditor != nil {
+			streamUp = &teeReader{ReadCloser: streamUp, buf: &audited}
+		}
+
+		var timer *decodeTimer
+		if cfg.decodeTimeout > 0 {
+			timer = startDecodeTimer(hResp, hReq.Body, cfg.decodeTimeout)
+		}
+		decStart := time.Now()
+		var err error
+		req, err = e.reqc.Dec(withContentType(ctx, hReq.Header.Get("Content-Type")), streamUp)
+		ev.DecodeDuration = time.Since(decStart)
+		if timer.stop(err) {
+			slog.LogAttrs(ctx, slog.LevelInfo, "Request timeout",
+				slog.String("error", fmt.Sprintf("decoding: %s", err)))
+			http.Error(hResp, "Request timeout.", http.StatusRequestTimeout)
+			return
+		}
+		if _, ok := errors.AsType[*http.MaxBytesError](err); ok {
+			slog.LogAttrs(ctx, slog.LevelInfo, "Request too large",
+				slog.String("error", fmt.Sprintf("decoding: %s", err)))
+			http.Error(hResp, "Request too large.", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelInfo, "Bad request",
+				slog.String("error", fmt.Sprintf("decoding: %s", err)))
+			msg := "Unable to decode request."
+			if cfg.debugErrors {
+				msg = "Unable to decode request: " + decodeErrorDetail(err)
+			}
+			http.Error(hResp, msg, http.StatusBadRequest)
+			return
+		}
 
-			// TODO middleware
+		if cfg.stripQueryKey && streamedInURL {
+			stripQuery(hReq, e.opts.queryKey)
+		}
+
+		// TODO middleware
 
-			if val, ok := any(req).(Validable); ok {
-				if err := val.Validate(); err != nil {
-					http.Error(hResp, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		if val, ok := any(req).(Validable); ok {
+			if err := val.Validate(); err != nil {
+				ev.ValidationFailed = true
+				if v, ok := asValidationError(err); ok {
+					writeValidationError(hResp, v)
 					return
 				}
+				http.Error(hResp, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+				return
 			}
 		}
 
-		// Create Response
+		if cfg.auditor != nil {
+			if err := cfg.auditor.Audit(ctx, hReq, audited.Bytes()); err != nil {
+				status, msg := errorStatus(err, http.StatusInternalServerError)
+				slog.LogAttrs(ctx, slog.LevelWarn, "Audit Error",
+					slog.String("error", fmt.Sprintf("auditing: %s", err)))
+				http.Error(hResp, msg, status)
+				return
+			}
+		}
+	}
 
-		resp, err := p(ctx, req)
-		if err != nil {
-			// TODO find a way to have error codecs or at least to make errors.Is work with these.
+	// Create Response
 
-			status := http.StatusBadRequest
-			var msg string
-			if serr, ok := err.(ErrorResponse); ok {
-				status = serr.Status()
-				msg = serr.Message()
-			}
-			if msg == "" {
-				msg = http.StatusText(status)
-			}
+	resp, err := p(ctx, req)
+	if rd, ok := errors.AsType[*Redirect](err); ok {
+		http.Redirect(hResp, hReq, rd.Location, rd.status())
+		return
+	}
+	if err != nil {
+		// TODO find a way to have error codecs or at least to make errors.Is work with these.
 
-			slog.LogAttrs(ctx, slog.LevelInfo, "Handler Error",
-				slog.String("error", fmt.Sprintf("processing: %s", err)))
-			http.Error(hResp, msg, status)
-			return
-		}
-		streamDown, err := e.resc.Co(ctx, resp)
-		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelWarn, "Encoder Error",
-				slog.String("error", fmt.Sprintf("encoding: %s", err)))
-			http.Error(hResp, "Failed to encode response.", http.StatusInternalServerError)
+		slog.LogAttrs(ctx, slog.LevelInfo, "Handler Error",
+			slog.String("error", fmt.Sprintf("processing: %s", err)))
+		if v, ok := asValidationError(err); ok {
+			writeValidationError(hResp, v)
 			return
 		}
+		status, msg := errorStatus(err, http.StatusBadRequest)
+		http.Error(hResp, msg, status)
+		return
+	}
+	encStart := time.Now()
+	var streamDown io.Reader
+	encCtx := withKeepAlive(ctx, cfg.keepAlive)
+	if e.resc.CoTo != nil {
+		// Encoding happens while the response is sent, so it is accounted for in the copy.
+		streamDown = encoderTo{encode: func(w io.Writer) error { return e.resc.CoTo(encCtx, w, resp) }}
+	} else {
+		streamDown, err = e.resc.Co(encCtx, resp)
+	}
+	ev.EncodeDuration = time.Since(encStart)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Encoder Error",
+			slog.String("error", fmt.Sprintf("encoding: %s", err)))
+		http.Error(hResp, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
 
-		// Send Response
+	// Send Response
 
-		hResp.Header().Set("Content-Type", e.resc.ContentType)
-		if c, ok := streamDown.(io.Closer); ok {
+	status := statusFromContext(ctx)
+	if _, ok := streamDown.(empty); ok {
+		hResp.WriteHeader(cmp.Or(status, http.StatusNoContent))
+		return
+	}
+	if ct := contentTypeOf(streamDown, e.resc.ContentType); ct != "" {
+		hResp.Header().Set("Content-Type", ct)
+	}
+	if c, ok := streamDown.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				slog.LogAttrs(ctx, slog.LevelInfo, "streamDown Close",
+					slog.String("error", fmt.Sprintf("close: %s", err)))
+			}
+		}()
+	}
+	var (
+		dst http.ResponseWriter = hResp
+		// failed is set when the response is replaced by an error.
+		failed bool
+	)
+	if len(cfg.encodings) > 0 {
+		// The response depends on Accept-Encoding even when it is not compressed, for caches.
+		hResp.Header().Add("Vary", "Accept-Encoding")
+	}
+	enc, compress := negotiateEncoding(hReq.Header.Get("Accept-Encoding"), cfg.encodings)
+	if size, ok := responseSize(streamDown, hResp.Header()); compress && ok && size < cfg.compressMinSize {
+		compress = false
+	}
+	if compress {
+		cw, err := newCompressWriter(hResp, enc)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelWarn, "Compression Error",
+				slog.String("error", err.Error()))
+		} else {
+			dst = cw
 			defer func() {
-				if err := c.Close(); err != nil {
+				if failed {
+					return
+				}
+				if err := cw.Close(); err != nil {
 					slog.LogAttrs(ctx, slog.LevelInfo, "streamDown Close",
-						slog.String("error", fmt.Sprintf("close: %s", err)))
+						slog.String("error", fmt.Sprintf("compressor close: %s", err)))
 				}
 			}()
 		}
-		if _, err := io.Copy(hResp, streamDown); err != nil {
-			slog.LogAttrs(ctx, slog.LevelInfo, "streamDown Copy",
-				slog.String("error", fmt.Sprintf("copy: %s", err)))
+	}
+	if iw, ok := hResp.(*idempotentWriter); ok && dst != hResp {
+		dst = iw.plainBody(dst)
+	}
+	if respBody != nil {
+		dst = &teeResponseWriter{ResponseWriter: dst, buf: respBody}
+	}
+	if e.resc.KeepOpen {
+		// Streamed responses can fail after the status was sent, declaring the trailers
+		// makes sure they are delivered even if the response turns out to be short.
+		hResp.Header().Set("Trailer", statusTrailer+", "+messageTrailer)
+	}
+	if status != 0 {
+		hResp.WriteHeader(status)
+	}
+	n, err := copyContext(ctx, dst, streamDown)
+	ev.BytesOut = n
+	if err != nil {
+		if _, ok := streamDown.(encoderTo); ok && n == 0 && status == 0 {
+			slog.LogAttrs(ctx, slog.LevelWarn, "Encoder Error",
+				slog.String("error", fmt.Sprintf("encoding: %s", err)))
+			failed = true
+			for _, h := range []string{"Content-Encoding", "Vary", "Trailer"} {
+				hResp.Header().Del(h)
+			}
+			http.Error(hResp, "Failed to encode response.", http.StatusInternalServerError)
 			return
 		}
-	})
+		level := slog.LevelInfo
+		if ctx.Err() != nil {
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(ctx, level, "streamDown Copy",
+			slog.String("error", fmt.Sprintf("copy: %s", err)))
+		setErrorTrailers(hResp, err)
+		return
+	}
 }
 
 ////////////
@@ -175,97 +624,361 @@ func (e *Endpoint[Response, Request]) Register(m Mux, p Procedure[Response, Requ
 var ErrBadOrigin = errors.New("bad connector origin")
 
 // Transport can be used to connect to a remote Endpoint.
+//
+// Transports are safe for concurrent use and meant to be shared: create one per origin with [NewTransport]
+// and bind all the endpoints of that origin to it, with [Endpoint.Remote] or [Remote], so that they share
+// connections and options.
 type Transport struct {
 	origin  string
 	client  *http.Client
-	cookies []*http.Cookie
+	retry   *RetryPolicy
+	breaker *breaker
+	metrics ClientMetrics
+	header  http.Header
+
+	// cookies are sent with every request, captureCookies makes responses update them.
+	cookieMu       sync.Mutex
+	cookies        []*http.Cookie
+	captureCookies bool
+	// jar stores cookies set by responses, if not nil.
+	jar http.CookieJar
+
+	// encodings are the content codings the transport can decompress.
+	encodings []Encoding
+
+	// clientCert is the certificate used for mutual TLS, if not nil, roots verify servers.
+	clientCert *tls.Certificate
+	roots      *x509.CertPool
+
+	followRedirects bool
+	// requireHTTPS makes the transport refuse origins and redirects that are not https.
+	requireHTTPS bool
+
+	// coalesce makes concurrent identical reads share a single call.
+	coalesce bool
+	flights  flightGroup
+
+	// maxResponseBytes limits the size of response bodies, after decompression, if positive.
+	maxResponseBytes int64
+
+	// idempotencyKeys makes the transport send a random idempotency key with calls that are not idempotent.
+	idempotencyKeys bool
+
+	// newRequest constructs the outgoing requests.
+	newRequest RequestConstructor
+
+	// prepare is called on every outgoing request, in order, after headers and cookies are set.
+	prepare []func(context.Context, *http.Request) error
+
+	// signer signs outgoing requests after they are prepared.
+	signer Signer
+
+	// inflight tracks the calls in flight, for [Transport.Drain].
+	inflight inflight
 }
 
+// TransportOption configures optional behavior of a [Transport].
+type TransportOption func(*Transport)
+
 // NewTransport creates a new Connector.
 //
 // The only mandatory parameter is origin, which must have a "http" or "https" scheme,
 // a valid domain, and must not contain any path or query.
-func NewTransport(origin string, client *http.Client, cookies []*http.Cookie) (*Transport, error) {
+//
+// Servers listening on a unix domain socket can be reached with an origin like "unix:///var/run/app.sock":
+// the whole path is the one of the socket, and requests are sent as plain HTTP with "localhost" as Host.
+// The Host can be set with the "host" query parameter, and a prefix for the paths of endpoints with
+// the "path" one, for example "unix:///var/run/app.sock?host=app.internal&path=/api".
+// If a client is given, its Transport must be nil or a [*http.Transport], which is cloned to dial the socket.
+//
+// Redirects are not followed: a 3xx response makes calls fail with a [WireError] that carries
+// the status code and the redirect location. Use [WithFollowRedirects] to follow them,
+// or pass a client with a CheckRedirect policy, which is always respected.
+func NewTransport(origin string, client *http.Client, cookies []*http.Cookie, opts ...TransportOption) (*Transport, error) {
 	c := &Transport{
 		origin:  origin,
 		client:  client,
 		cookies: cookies,
+		metrics: nopClientMetrics{},
+
+		newRequest: http.NewRequestWithContext,
+	}
+	for _, o := range opts {
+		o(c)
 	}
 
 	u, err := url.Parse(c.origin)
 	switch {
 	case err != nil:
 		return nil, fmt.Errorf("%w: invalid URL: %w", ErrBadOrigin, err)
+	case c.requireHTTPS && !strings.EqualFold(u.Scheme, "https"):
+		return nil, fmt.Errorf(`%w: scheme must be "https": %q`, ErrBadOrigin, c.origin)
+	case strings.EqualFold(u.Scheme, "unix"):
+		if err := c.dialUnix(u); err != nil {
+			return nil, err
+		}
 	case !strings.EqualFold(u.Scheme, "http") &&
 		!strings.EqualFold(u.Scheme, "https"):
-		return nil, fmt.Errorf(`%w: scheme must be "http" or "https": %q`, ErrBadOrigin, c.origin)
+		return nil, fmt.Errorf(`%w: scheme must be "http", "https" or "unix": %q`, ErrBadOrigin, c.origin)
 	case u.Path != "":
 		return nil, fmt.Errorf("%w: path must be empty: %q", ErrBadOrigin, u.Path)
 	case u.RawQuery != "":
 		return nil, fmt.Errorf("%w: query must be empty: %q", ErrBadOrigin, u.RawQuery)
 	}
+	if c.clientCert != nil {
+		if err := c.configureTLS(u); err != nil {
+			return nil, err
+		}
+	}
 
-	if client == nil {
+	if c.client == nil {
 		c.client = http.DefaultClient
 	}
+	c.client = withJar(c.client, c.jar)
+	if !c.followRedirects && c.client.CheckRedirect == nil {
+		cl := *c.client
+		cl.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		c.client = &cl
+	}
+	if c.requireHTTPS {
+		c.client = httpsOnly(c.client)
+	}
 	return c, nil
 }
 
-// RemoteWithOrigin is like Remote, but it creates a transport for the given origin.
+// Clone returns a copy of t with opts applied on top of its options, for example to use different
+// cookies, headers or credentials for each tenant of a service.
+//
+// The copy shares the [http.Client], and thus the connection pool, and the circuit breaker of t.
+// Options that configure the connection, like [WithClientCertificate] and [WithFollowRedirects], have no effect,
+// while [WithCookieJar] gives the copy its own jar.
+// Headers set with [WithHeaders] are merged with the ones of t, credentials set with [WithBasicAuth]
+// or [WithTokenProvider] take precedence over the ones of t.
+func (t *Transport) Clone(opts ...TransportOption) *Transport {
+	c := &Transport{
+		origin:           t.origin,
+		client:           t.client,
+		cookies:          t.requestCookies(),
+		captureCookies:   t.captureCookies,
+		jar:              t.jar,
+		retry:            t.retry,
+		breaker:          t.breaker,
+		metrics:          t.metrics,
+		header:           t.header.Clone(),
+		encodings:        t.encodings,
+		clientCert:       t.clientCert,
+		roots:            t.roots,
+		followRedirects:  t.followRedirects,
+		requireHTTPS:     t.requireHTTPS,
+		coalesce:         t.coalesce,
+		idempotencyKeys:  t.idempotencyKeys,
+		maxResponseBytes: t.maxResponseBytes,
+		newRequest:       t.newRequest,
+		prepare:          slices.Clip(t.prepare),
+		signer:           t.signer,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	c.client = withJar(c.client, c.jar)
+	return c
+}
+
+// WithCookies makes the transport send cookies with every request, instead of the ones passed to [NewTransport].
+//
+// It is meant to be used with [Transport.Clone].
+func WithCookies(cookies ...*http.Cookie) TransportOption {
+	return func(t *Transport) { t.cookies = cookies }
+}
+
+// RequestConstructor constructs the HTTP request for a call to the given URL, which is the transport origin
+// followed by the endpoint path and, for endpoints that are not state-changing, the encoded query.
+//
+// The default one is [http.NewRequestWithContext].
+type RequestConstructor func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error)
+
+// WithRequestConstructor makes the transport construct requests with newRequest,
+// for example to rewrite URLs or add query parameters.
+//
+// Headers, cookies and the other transport options are still applied to the returned request.
+func WithRequestConstructor(newRequest RequestConstructor) TransportOption {
+	return func(t *Transport) { t.newRequest = newRequest }
+}
+
+// WithHeaders makes the transport send h with every request.
+//
+// Headers set per call with [WithCallHeader] replace the ones with the same name, and the Content-Type header
+// is always set by the request codec. Cookies are merged by name, see [WithCallCookie].
+func WithHeaders(h http.Header) TransportOption {
+	return func(t *Transport) {
+		t.header = t.header.Clone()
+		if t.header == nil {
+			t.header = http.Header{}
+		}
+		for k, v := range h {
+			t.header[http.CanonicalHeaderKey(k)] = slices.Clone(v)
+		}
+	}
+}
+
+// WithDefaultAcceptLanguage makes the transport send an Accept-Language header listing langs
+// in order of preference.
+//
+// It can be overridden per call with [WithAcceptLanguage].
+func WithDefaultAcceptLanguage(langs ...string) TransportOption {
+	return func(t *Transport) {
+		t.header = t.header.Clone()
+		if t.header == nil {
+			t.header = http.Header{}
+		}
+		t.header.Set("Accept-Language", formatAcceptLanguage(langs))
+	}
+}
+
+// WithFollowRedirects makes the transport follow redirects as the [http.Client] would by default.
+//
+// Following redirects can send requests, including their credentials, to unexpected hosts
+// and can change the method of state-changing requests, so it should only be enabled for trusted origins.
+func WithFollowRedirects() TransportOption {
+	return func(t *Transport) { t.followRedirects = true }
+}
+
+// WithExpectContinue makes the transport send requests that have a body with an "Expect: 100-continue" header,
+// so that the body is only sent once the server is ready to read it, and not at all if the server rejects
+// the request upfront, for example because it is unauthenticated or too large, see [WithMaxRequestBytes].
+//
+// It is meant for endpoints that receive large uploads. The [*http.Transport] of the client must
+// have an ExpectContinueTimeout, as the default one does, otherwise bodies are sent right away.
+func WithExpectContinue() TransportOption {
+	return func(t *Transport) {
+		t.prepare = append(t.prepare, func(_ context.Context, r *http.Request) error {
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Header.Set("Expect", "100-continue")
+			}
+			return nil
+		})
+	}
+}
+
+// WithBasicAuth makes the transport authenticate every request with HTTP Basic Auth.
+func WithBasicAuth(username, password string) TransportOption {
+	return func(t *Transport) {
+		t.prepare = append(t.prepare, func(_ context.Context, r *http.Request) error {
+			r.SetBasicAuth(username, password)
+			return nil
+		})
+	}
+}
+
+// TokenProvider returns the bearer token to authenticate a request with.
+//
+// It is called before every request, including retries, so implementations that
+// fetch tokens remotely should cache them and only refresh them when they are about to expire.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// WithTokenProvider makes the transport authenticate every request with an
+// "Authorization: Bearer" header carrying the token returned by p.
+//
+// If p fails the call fails with its error.
+func WithTokenProvider(p TokenProvider) TransportOption {
+	return func(t *Transport) {
+		t.prepare = append(t.prepare, func(ctx context.Context, r *http.Request) error {
+			tok, err := p(ctx)
+			if err != nil {
+				return fmt.Errorf("obtaining token: %w", err)
+			}
+			r.Header.Set("Authorization", "Bearer "+tok)
+			return nil
+		})
+	}
+}
+
+// RemoteWithOrigin is like Remote, but it uses a transport for the given origin with default options.
+//
+// The transport is shared with all the other procedures created with RemoteWithOrigin for the same origin.
+// To configure it, create a [Transport] with [NewTransport] and use Remote.
 //
 // If the origin is invalid, RemoteWithOrigin panics.
 func (e *Endpoint[Response, Request]) RemoteWithOrigin(origin string) Procedure[Response, Request] {
+	return e.Remote(originTransport(origin))
+}
+
+// originTransports caches the transports used by RemoteWithOrigin, by origin.
+var originTransports struct {
+	sync.Mutex
+	m map[string]*Transport
+}
+
+// originTransport returns the shared transport with default options for origin, or panics if origin is invalid.
+func originTransport(origin string) *Transport {
+	originTransports.Lock()
+	defer originTransports.Unlock()
+	if conn, ok := originTransports.m[origin]; ok {
+		return conn
+	}
 	conn, err := NewTransport(origin, nil, nil)
 	if err != nil {
 		panic(err)
 	}
-	return e.Remote(conn)
+	if originTransports.m == nil {
+		originTransports.m = map[string]*Transport{}
+	}
+	originTransports.m[origin] = conn
+	return conn
 }
 
 // Remote returns the remote procedure, ready to be called.
 //
 // The endpoint needs to be registered and served on the remote server.
+//
+// Requests of state-changing endpoints are streamed to the server as they are encoded,
+// see [Codec] for details.
 func (e *Endpoint[Response, Request]) Remote(conn *Transport) Procedure[Response, Request] {
-	rawURL := conn.origin + e.path
-	reqCtor := func(ctx context.Context, streamUp io.Reader) (*http.Request, error) {
-		return http.NewRequestWithContext(ctx, e.method, rawURL, streamUp)
-	}
-	if !e.stateChanging {
-		reqCtor = func(ctx context.Context, streamUp io.Reader) (*http.Request, error) {
-			buf, err := io.ReadAll(streamUp)
-			if err != nil {
-				return nil, err
-			}
-			q := "?" + QueryKey + "=" + url.QueryEscape(string(buf))
-			return http.NewRequestWithContext(ctx, e.method, rawURL+q, nil)
-		}
+	if conn.coalesce && (e.method == http.MethodGet || e.method == http.MethodHead) && !e.resc.KeepOpen {
+		return e.coalesced(conn)
 	}
+	return e.call(conn)
+}
 
+// call returns the remote procedure that issues a call for every invocation.
+func (e *Endpoint[Response, Request]) call(conn *Transport) Procedure[Response, Request] {
 	return func(ctx context.Context, req Request) (resp Response, err error) {
 		var zero Response
 
-		// Create Request
-
-		streamUp, err := e.reqc.Co(ctx, req)
-		if err != nil {
-			return zero, fmt.Errorf("encoding request: %w", err)
-		}
-		hReq, err := reqCtor(ctx, streamUp)
-		if err != nil {
-			return zero, fmt.Errorf("converting request to HTTP: %w", err)
-		}
-		hReq.Header.Set("Content-Type", e.reqc.ContentType)
-		for _, cookie := range conn.cookies {
-			hReq.AddCookie(cookie)
+		if val, ok := any(req).(Validable); ok && e.opts.clientValidation {
+			if err := val.Validate(); err != nil {
+				if v, ok := asValidationError(err); ok {
+					return zero, v
+				}
+				return zero, BadRequest(fmt.Sprintf("Invalid request: %v", err))
+			}
 		}
 
-		// TODO MW
+		if err := conn.inflight.start(); err != nil {
+			return zero, err
+		}
+		defer conn.inflight.done()
 
-		// Roundtrip
+		start := time.Now()
+		ev := ClientEvent{Method: e.method, Path: e.path}
+		conn.metrics.CallStart(ctx, ev)
+		defer func() {
+			ev.Duration = time.Since(start)
+			ev.Err = err
+			conn.metrics.CallEnd(ctx, ev)
+		}()
 
-		hResp, err := conn.client.Do(hReq) //nolint: gosec // these are hardcoded in sources.
+		hResp, streamUp, err := e.roundTrip(ctx, conn, req, &ev)
 		if err != nil {
-			return zero, fmt.Errorf("issuing request: %w", err)
+			return zero, err
+		}
+		opts := callOptionsFromContext(ctx)
+		if info := opts.info; info != nil {
+			info.Status = hResp.StatusCode
+			info.Header = hResp.Header
+		}
+		if opts.hook != nil {
+			opts.hook(hResp)
 		}
 
 		// Cleanups
@@ -289,52 +1002,186 @@ func (e *Endpoint[Response, Request]) Remote(conn *Transport) Procedure[Response
 
 		// Decoding
 
-		if hResp.StatusCode != http.StatusOK {
-			return zero, readErr(hResp)
+		if err := decompressBody(hResp, conn.encodings); err != nil {
+			return zero, err
 		}
-		if ct := hResp.Header.Get("Content-Type"); ct != e.resc.ContentType {
-			return zero, fmt.Errorf("Content-Type: want %q got %q", e.resc.ContentType, ct)
+		if conn.maxResponseBytes > 0 {
+			hResp.Body = &limitedBody{ReadCloser: hResp.Body, left: conn.maxResponseBytes}
 		}
-		resp, err = e.resc.Dec(ctx, hResp.Body)
-		if err != nil {
-			return zero, fmt.Errorf("decoding response: %w", err)
+		if hResp.StatusCode >= http.StatusOK && hResp.StatusCode < http.StatusMultipleChoices {
+			hResp.Body = &trailerReader{ReadCloser: hResp.Body, resp: hResp}
 		}
-		return resp, nil
+		return e.decodeResponse(ctx, hResp)
 	}
 }
 
-var (
-	_ ErrorResponse = &WireError{}
-	_ error         = &WireError{}
-)
+// newRequest creates the HTTP request to send streamUp, the encoded request, to the endpoint.
+func (e *Endpoint[Response, Request]) newRequest(ctx context.Context, conn *Transport, streamUp io.Reader) (*http.Request, error) {
+	path, err := expandPath(e.path, callOptionsFromContext(ctx).pathValues)
+	if err != nil {
+		return nil, err
+	}
+	rawURL := conn.origin + path
+	if e.stateChanging {
+		switch r := streamUp.(type) {
+		case empty:
+			streamUp = http.NoBody
+		case *pooledReader:
+			// The transport might read the body after the call returns, when the buffer is back in the pool.
+			buf, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			_ = r.Close()
+			streamUp = bytes.NewReader(buf)
+		}
+		return conn.newRequest(ctx, e.method, rawURL, streamUp)
+	}
 
-// WireError is an error that can be sent over the wire.
-//
-// It allows to set HTTP status and message.
-type WireError struct {
-	Msg  string
-	Code int
+	buf, err := io.ReadAll(streamUp)
+	if err != nil {
+		return nil, err
+	}
+	q := "?" + url.QueryEscape(e.opts.queryKey) + "=" + url.QueryEscape(string(buf))
+	if e.rawQuery {
+		q = ""
+		if len(buf) > 0 {
+			q = "?" + string(buf)
+		}
+	}
+	if e.opts.maxQueryLen > 0 && len(strings.TrimPrefix(q, "?")) > e.opts.maxQueryLen {
+		return conn.newRequest(ctx, http.MethodPost, rawURL, bytes.NewReader(buf))
+	}
+	return conn.newRequest(ctx, e.method, rawURL+q, nil)
 }
 
-// Error implements [error].
-func (w *WireError) Error() string {
-	return fmt.Sprintf("%v %v: %v", w.Code, http.StatusText(w.Code), w.Msg)
+// emptyResponse returns the Response of calls whose response has no body: [http.NoBody] for
+// responses that are readers, so that callers can read and close them, or the zero value.
+func emptyResponse[Response any]() Response {
+	var zero Response
+	switch p := any(&zero).(type) {
+	case *io.ReadCloser:
+		*p = http.NoBody
+	case *io.Reader:
+		*p = http.NoBody
+	}
+	return zero
 }
 
-// Message implements [ErrorResponse].
-func (w *WireError) Message() string { return w.Msg }
-
-// Status implements [ErrorResponse].
-func (w *WireError) Status() int { return w.Code }
-
-func readErr(resp *http.Response) error {
-	buf, err := io.ReadAll(resp.Body)
+// decodeResponse converts hResp to a Response, or to an error if the call failed.
+//
+// It doesn't close the response body.
+func (e *Endpoint[Response, Request]) decodeResponse(ctx context.Context, hResp *http.Response) (Response, error) {
+	var zero Response
+	switch code := hResp.StatusCode; {
+	case code == http.StatusOK && !e.opts.allowEmptyResponse:
+	case code == http.StatusNoContent:
+		return emptyResponse[Response](), nil
+	case code >= http.StatusOK && code < http.StatusMultipleChoices:
+		// Other successful statuses might come without a body.
+		br := bufio.NewReader(hResp.Body)
+		if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+			return emptyResponse[Response](), nil
+		}
+		hResp.Body = struct {
+			io.Reader
+			io.Closer
+		}{br, hResp.Body}
+	default:
+		return zero, readErr(hResp)
+	}
+	if ct := hResp.Header.Get("Content-Type"); !e.opts.lenientContentType &&
+		e.resc.ContentType != "" && !sameMediaType(ct, e.resc.ContentType) {
+		return zero, fmt.Errorf("Content-Type: want %q got %q", e.resc.ContentType, ct)
+	}
+	resp, err := e.resc.Dec(withContentType(ctx, hResp.Header.Get("Content-Type")), hResp.Body)
 	if err != nil {
-		return fmt.Errorf("read response body: %w", err)
+		return zero, fmt.Errorf("decoding response: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
-	return &WireError{
-		Code: resp.StatusCode,
-		Msg:  string(bytes.TrimSpace(buf)),
+	return resp, nil
+}
+
+// roundTrip encodes the request and issues it, retrying according to the transport [RetryPolicy].
+//
+// On success the caller is responsible for closing both the response body and the returned request stream.
+func (e *Endpoint[Response, Request]) roundTrip(
+	ctx context.Context, conn *Transport, req Request, ev *ClientEvent,
+) (*http.Response, io.Reader, error) {
+	ctx = withIdempotencyKey(ctx, conn, e.method)
+	for attempt := 1; ; attempt++ {
+		ev.Attempt = attempt
+		ev.Status = 0
+
+		// Create Request
+
+		streamUp, err := e.reqc.Co(ctx, req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encoding request: %w", err)
+		}
+		hReq, err := e.newRequest(ctx, conn, streamUp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("converting request to HTTP: %w", err)
+		}
+		// Per-call headers replace the transport ones with the same name, cookies are merged by name.
+		opts := callOptionsFromContext(ctx)
+		for k, v := range conn.header {
+			hReq.Header[k] = slices.Clone(v)
+		}
+		for k, v := range opts.header {
+			hReq.Header[k] = slices.Clone(v)
+		}
+		hReq.Header.Set("Content-Type", contentTypeOf(streamUp, e.reqc.ContentType))
+		setTimeoutHeader(ctx, hReq)
+		setCookies(hReq, conn.requestCookies(), hReq.Cookies(), opts.cookies)
+		for _, p := range conn.prepareHooks() {
+			if err := p(ctx, hReq); err != nil {
+				if c, ok := streamUp.(io.Closer); ok {
+					_ = c.Close()
+				}
+				return nil, nil, fmt.Errorf("preparing request: %w", err)
+			}
+		}
+
+		// TODO MW
+
+		// Roundtrip
+
+		probe, err := conn.breaker.allow()
+		if err != nil {
+			if c, ok := streamUp.(io.Closer); ok {
+				_ = c.Close()
+			}
+			return nil, nil, fmt.Errorf("issuing request: %w", err)
+		}
+		hResp, err := conn.client.Do(hReq) //nolint: gosec // these are hardcoded in sources.
+		if hResp != nil {
+			ev.Status = hResp.StatusCode
+			conn.storeCookies(hResp)
+		}
+		// Only failures caused by the caller are not counted: timeouts of the client are.
+		canceled := err != nil && ctx.Err() != nil
+		conn.breaker.done(probe, !canceled, err != nil || hResp.StatusCode >= http.StatusInternalServerError)
+		retriable := idempotent(e.method) || hReq.Header.Get(IdempotencyKeyHeader) != ""
+		delay, retry := conn.retry.next(ctx, attempt, retriable, hResp, err)
+		if !retry {
+			if err != nil {
+				return nil, nil, fmt.Errorf("issuing request: %w", err)
+			}
+			return hResp, streamUp, nil
+		}
+
+		// Retry
+
+		conn.metrics.CallRetry(ctx, ClientEvent{Method: ev.Method, Path: ev.Path, Attempt: attempt, Status: ev.Status, Err: err})
+		if hResp != nil {
+			_, _ = io.Copy(io.Discard, hResp.Body)
+			_ = hResp.Body.Close()
+		}
+		if c, ok := streamUp.(io.Closer); ok {
+			_ = c.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, nil, fmt.Errorf("waiting to retry: %w", err)
+		}
 	}
 }
@@ -2,10 +2,27 @@ package srpc_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/empijei/srpc"
 	"github.com/empijei/tst"
@@ -87,6 +104,26 @@ func TestValidation(t *testing.T) {
 		tst.Is(http.StatusBadRequest, we.Code, t)
 		tst.Is("Invalid request: invalid: B cannot be empty", we.Msg, t)
 	})
+
+	t.Run("Client", func(t *testing.T) {
+		cep := srpc.NewEndpointJSON[Resp, ValReq](http.MethodPost, "/val", srpc.WithClientValidation())
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			mux.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		c := cep.RemoteWithOrigin(srv.URL)
+
+		_, err := c(ctx, ValReq{""})
+		we := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+		tst.Is(http.StatusBadRequest, we.Code, t)
+		tst.Is("Invalid request: invalid: B cannot be empty", we.Msg, t)
+		tst.Is(0, calls.Load(), t)
+
+		tst.Is(Resp{"ok"}, tst.Do(c(ctx, ValReq{"ok"}))(t), t)
+		tst.Is(1, calls.Load(), t)
+	})
 }
 
 func TestErrors(t *testing.T) {
@@ -174,3 +211,1049 @@ func TestSugar(t *testing.T) {
 		tst.Is(Resp{"read"}, got, t)
 	})
 }
+
+func TestNewEndpointPanics(t *testing.T) {
+	tst.Go(t)
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"Post", "/foo", `method must be a known HTTP method, "Post" provided`},
+		{"GETT", "/foo", `method must be a known HTTP method, "GETT" provided`},
+		{"", "/foo", `method must be a known HTTP method, "" provided`},
+		{http.MethodPost, "foo", `path must start with '/', "foo" provided`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			defer func() {
+				tst.Is[any](tt.want, recover(), t)
+			}()
+			srpc.NewEndpointJSON[Resp, Req](tt.method, tt.path)
+			t.Error("NewEndpoint did not panic")
+		})
+	}
+}
+
+func TestPathValues(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	del := srpc.NewEndpointN(http.MethodDelete, "/items/{id}")
+	del.Register(mux, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, srpc.PathValue(ctx, "id"))
+		return nil
+	})
+	files := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/files/{owner}/{path...}")
+	files.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.PathValue(ctx, "owner") + ":" + srpc.PathValue(ctx, "path") + ":" + req.B}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("Delete", func(t *testing.T) {
+		c := del.RemoteWithOrigin(srv.URL)
+		tst.No(c(srpc.WithPathValue(ctx, "id", "42")), t)
+		tst.No(c(srpc.WithPathValue(ctx, "id", "a/b c")), t)
+		tst.Is([]string{"42", "a/b c"}, deleted, t)
+	})
+
+	t.Run("Remainder", func(t *testing.T) {
+		c := files.RemoteWithOrigin(srv.URL)
+		ctx := srpc.WithPathValue(srpc.WithPathValue(ctx, "owner", "me"), "path", "dir/file name.txt")
+		got := tst.Do(c(ctx, Req{"q"}))(t)
+		tst.Is(Resp{"me:dir/file name.txt:q"}, got, t)
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		err := del.RemoteWithOrigin(srv.URL)(ctx)
+		tst.Err(`missing value for path wildcard "id"`, err, t)
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{"ok"}, nil
+	}, srpc.WithAuthenticator(srpc.AuthenticatorFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "hunter2" {
+			return nil, srpc.Unauthorized("bad credentials")
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+			return nil, srpc.Unauthorized("missing cookie")
+		}
+		return ctx, nil
+	})))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	cookies := []*http.Cookie{{Name: "session", Value: "s1"}}
+
+	t.Run("Missing", func(t *testing.T) {
+		conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), cookies))(t)
+		_, err := Ep.Remote(conn)(ctx, Req{})
+		tst.Is(true, srpc.IsUnauthorized(err), t)
+	})
+	t.Run("WithCookies", func(t *testing.T) {
+		conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), cookies, srpc.WithBasicAuth("admin", "hunter2")))(t)
+		got := tst.Do(Ep.Remote(conn)(ctx, Req{}))(t)
+		tst.Is(Resp{"ok"}, got, t)
+	})
+}
+
+func TestTokenProvider(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{srpc.HeaderFromContext(ctx, "Authorization")}, nil
+	}, srpc.WithHeadersInContext("Authorization"))
+
+	var calls int
+	errExpired := errors.New("refresh token expired")
+	conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithTokenProvider(func(ctx context.Context) (string, error) {
+		calls++
+		if calls > 1 {
+			return "", errExpired
+		}
+		return "tok1", nil
+	})))(t)
+	c := Ep.Remote(conn)
+
+	got := tst.Do(c(ctx, Req{}))(t)
+	tst.Is(Resp{"Bearer tok1"}, got, t)
+	_, err := c(ctx, Req{})
+	tst.Is(true, errors.Is(err, errExpired), t)
+}
+
+func TestRedirects(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{"new"}, nil })
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/old")
+	mux.Handle("POST /old", http.RedirectHandler("/foo", http.StatusTemporaryRedirect))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	t.Run("Default", func(t *testing.T) {
+		conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t)
+		_, err := ep.Remote(conn)(ctx, Req{})
+		werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+		tst.Is(http.StatusTemporaryRedirect, werr.Code, t)
+		tst.Is(`unexpected redirect to "/foo"`, werr.Msg, t)
+	})
+	t.Run("Follow", func(t *testing.T) {
+		conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil, srpc.WithFollowRedirects()))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, Req{}))(t)
+		tst.Is(Resp{"new"}, got, t)
+	})
+}
+
+func TestQueryKey(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/find", srpc.WithQueryKey("filter"))
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil })
+
+	var query string
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		mux.ServeHTTP(w, r)
+	})))(t)
+	got := tst.Do(ep.Remote(conn)(ctx, Req{"x"}))(t)
+	tst.Is(Resp{"x"}, got, t)
+	tst.Is(`filter=%7B%22B%22%3A%22x%22%7D`, query, t)
+}
+
+func TestMaxQueryLen(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/search", srpc.WithMaxQueryLen(64))
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil })
+	qep := srpc.NewEndpointQuery[Search, Search]("/query", srpc.WithMaxQueryLen(16))
+	qep.Register(mux, func(ctx context.Context, req Search) (Search, error) { return req, nil })
+
+	var method string
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		mux.ServeHTTP(w, r)
+	})))(t)
+	c := ep.Remote(conn)
+
+	got := tst.Do(c(ctx, Req{"short"}))(t)
+	tst.Is(Resp{"short"}, got, t)
+	tst.Is(http.MethodGet, method, t)
+
+	long := strings.Repeat("long", 32)
+	got = tst.Do(c(ctx, Req{long}))(t)
+	tst.Is(Resp{long}, got, t)
+	tst.Is(http.MethodPost, method, t)
+
+	s := Search{Term: long, Limit: 3}
+	gotS := tst.Do(qep.Remote(conn)(ctx, s))(t)
+	tst.Is(s, gotS, t)
+	tst.Is(http.MethodPost, method, t)
+}
+
+func TestResponseContentTypeParams(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil })
+	ct := "application/json; charset=utf-8"
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(&headerRewriter{ResponseWriter: w, ct: ct}, r)
+	})))(t)
+	c := Ep.Remote(conn)
+
+	got := tst.Do(c(ctx, Req{"x"}))(t)
+	tst.Is(Resp{"x"}, got, t)
+
+	ct = "text/html; charset=utf-8"
+	_, err := c(ctx, Req{"x"})
+	tst.Is(true, err != nil, t)
+
+	// Responses without a Content-Type are accepted.
+	ct = ""
+	got = tst.Do(c(ctx, Req{"z"}))(t)
+	tst.Is(Resp{"z"}, got, t)
+	ct = "text/html; charset=utf-8"
+
+	lenient := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/foo", srpc.WithLenientContentType())
+	got = tst.Do(lenient.Remote(conn)(ctx, Req{"y"}))(t)
+	tst.Is(Resp{"y"}, got, t)
+}
+
+// headerRewriter is a proxy that overrides the response Content-Type.
+type headerRewriter struct {
+	http.ResponseWriter
+	ct string
+}
+
+func (w *headerRewriter) WriteHeader(code int) {
+	w.Header().Set("Content-Type", w.ct)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerRewriter) Write(b []byte) (int, error) {
+	w.Header().Set("Content-Type", w.ct)
+	return w.ResponseWriter.Write(b)
+}
+
+func TestDeleteWithBody(t *testing.T) {
+	ctx := tst.Go(t)
+	type BulkDelete struct{ IDs []string }
+	type Deleted struct{ N int }
+	ep := srpc.NewEndpointJSON[Deleted, BulkDelete](http.MethodDelete, "/items")
+	mux := http.NewServeMux()
+	var failures atomic.Int32
+	ep.Register(mux, func(ctx context.Context, req BulkDelete) (Deleted, error) {
+		return Deleted{len(req.IDs)}, nil
+	})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Flaky") != "" && failures.Add(1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	req := BulkDelete{[]string{"a", "b", "c"}}
+
+	t.Run("InMemory", func(t *testing.T) {
+		conn := tst.Do(srpc.NewInMemoryTransport(h))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, req))(t)
+		tst.Is(Deleted{3}, got, t)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		got := tst.Do(ep.RemoteWithOrigin(srv.URL)(ctx, req))(t)
+		tst.Is(Deleted{3}, got, t)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil,
+			srpc.WithHeaders(http.Header{"X-Flaky": {"1"}}),
+			srpc.WithRetry(srpc.RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }})))(t)
+		got := tst.Do(ep.Remote(conn)(ctx, req))(t)
+		tst.Is(Deleted{3}, got, t)
+		tst.Is(int32(2), failures.Load(), t)
+	})
+}
+
+func TestHandler(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/items/{id}")
+	h := ep.Handler(func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B + srpc.PathValue(ctx, "id")}, nil
+	})
+	// A router that matches paths on its own and sets the path values.
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutPrefix(r.URL.Path, "/items/")
+		if !ok || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		r.SetPathValue("id", id)
+		h(w, r)
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(router))(t)
+	got := tst.Do(ep.Remote(conn)(srpc.WithPathValue(ctx, "id", "7"), Req{"item "}))(t)
+	tst.Is(Resp{"item 7"}, got, t)
+}
+
+func TestAlias(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	archive := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/thing/archive")
+	archived := archive.Alias(http.MethodPut, "/thing/{id}/archived")
+	proc := func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B + srpc.PathValue(ctx, "id")}, nil }
+	archive.Register(mux, proc)
+	archived.Register(mux, proc)
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+
+	got := tst.Do(archive.Remote(conn)(ctx, Req{"a"}))(t)
+	tst.Is(Resp{"a"}, got, t)
+	got = tst.Do(archived.Remote(conn)(srpc.WithPathValue(ctx, "id", "1"), Req{"a"}))(t)
+	tst.Is(Resp{"a1"}, got, t)
+}
+
+func TestNoContent(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	ep := srpc.NewEndpointJSON[struct{}, Req](http.MethodPost, "/write")
+	epw := (*srpc.EndpointW[Req])(&ep)
+	var got string
+	epw.Register(mux, func(ctx context.Context, req Req) error {
+		got = req.B
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, "/write", strings.NewReader(`{"B":"x"}`)))
+	tst.Is(http.StatusNoContent, rec.Code, t)
+	tst.Is("", rec.Header().Get("Content-Type"), t)
+	tst.Is(0, rec.Body.Len(), t)
+
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	tst.No(epw.Remote(conn)(ctx, Req{"y"}), t)
+	tst.Is("y", got, t)
+
+	// Procedures that return a nil reader give callers an empty one.
+	file := srpc.NewEndpoint(http.MethodGet, "/file", srpc.NewCodecReader("text/plain"), srpc.NewCodecJSON[Req]())
+	file.Register(mux, func(ctx context.Context, req Req) (io.ReadCloser, error) { return nil, nil })
+	rc := tst.Do(file.Remote(conn)(ctx, Req{}))(t)
+	body := tst.Do(io.ReadAll(rc))(t)
+	tst.Is(0, len(body), t)
+	tst.No(rc.Close(), t)
+}
+
+func TestAllowEmptyResponse(t *testing.T) {
+	ctx := tst.Go(t)
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("empty") == "" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"A":"found"}`))
+		}
+	})))(t)
+	strict := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/find")
+	lenient := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/find", srpc.WithAllowEmptyResponse())
+
+	got := tst.Do(lenient.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"found"}, got, t)
+
+	emptyConn := conn.Clone(srpc.WithRequestConstructor(func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, method, url+"?empty=1", body)
+	}))
+	got = tst.Do(lenient.Remote(emptyConn)(ctx, Req{}))(t)
+	tst.Is(Resp{}, got, t)
+	_, err := strict.Remote(emptyConn)(ctx, Req{})
+	tst.Is(true, err != nil, t)
+}
+
+func TestHeaders(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		h := []string{"X-Api-Version", "User-Agent", "Content-Type"}
+		var vals []string
+		for _, k := range h {
+			vals = append(vals, srpc.HeaderFromContext(ctx, k))
+		}
+		return Resp{strings.Join(vals, "|")}, nil
+	}, srpc.WithHeadersInContext("X-Api-Version", "User-Agent", "Content-Type"))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithHeaders(http.Header{
+		"X-Api-Version": {"2"},
+		"User-Agent":    {"tool/1.0"},
+		"Content-Type":  {"text/plain"},
+	})))(t)
+	c := Ep.Remote(conn)
+
+	got := tst.Do(c(ctx, Req{}))(t)
+	tst.Is(Resp{"2|tool/1.0|application/json"}, got, t)
+	got = tst.Do(c(srpc.WithCallHeader(ctx, "X-Api-Version", "3"), Req{}))(t)
+	tst.Is(Resp{"3|tool/1.0|application/json"}, got, t)
+}
+
+func TestRequestConstructor(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/ctor")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{req.B + "|" + srpc.HeaderFromContext(ctx, "X-Tenant") + "|" + srpc.HeaderFromContext(ctx, "X-Api-Version")}, nil
+	}, srpc.WithHeadersInContext("X-Tenant", "X-Api-Version"))
+	tenants := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Tenant", r.URL.Query().Get("tenant"))
+		mux.ServeHTTP(w, r)
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(tenants,
+		srpc.WithHeaders(http.Header{"X-Api-Version": {"2"}}),
+		srpc.WithRequestConstructor(func(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, method, url+"&tenant=acme", body)
+		})))(t)
+
+	got := tst.Do(ep.Remote(conn)(ctx, Req{"req"}))(t)
+	tst.Is(Resp{"req|acme|2"}, got, t)
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{"hello " + req.B}, nil
+	})
+	socket := filepath.Join(t.TempDir(), "srpc.sock")
+	l := tst.Do(new(net.ListenConfig).Listen(ctx, "unix", socket))(t)
+	// The endpoints are also mounted under a prefix, for a specific Host.
+	root := http.NewServeMux()
+	root.Handle("/", mux)
+	root.Handle("app.internal/", http.NotFoundHandler())
+	root.Handle("app.internal/api/", http.StripPrefix("/api", mux))
+	srv := &http.Server{Handler: root, ReadHeaderTimeout: time.Second}
+	go func() { _ = srv.Serve(l) }()
+	defer func() { tst.No(srv.Close(), t) }()
+
+	conn := tst.Do(srpc.NewTransport("unix://"+socket, nil, nil))(t)
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{"sidecar"}))(t)
+	tst.Is(Resp{"hello sidecar"}, got, t)
+
+	conn = tst.Do(srpc.NewTransport("unix://"+socket+"?host=app.internal&path=/api/", nil, nil))(t)
+	got = tst.Do(Ep.Remote(conn)(ctx, Req{"prefix"}))(t)
+	tst.Is(Resp{"hello prefix"}, got, t)
+
+	for _, origin := range []string{
+		"unix://host/app.sock",
+		"unix:///app.sock?path=api",
+		"unix:///app.sock?host=a/b",
+		"unix:///app.sock?other=1",
+	} {
+		_, err := srpc.NewTransport(origin, nil, nil)
+		tst.Is(true, errors.Is(err, srpc.ErrBadOrigin), t)
+	}
+}
+
+// clientCertificate returns a self-signed certificate for TLS client authentication.
+func clientCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key := tst.Do(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der := tst.Do(x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key))(t)
+	leaf := tst.Do(x509.ParseCertificate(der))(t)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
+func TestClientCertificate(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{"authenticated"}, nil
+	})
+	cert, leaf := clientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+	srv := httptest.NewUnstartedServer(mux)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithClientCertificate(cert, roots)))(t)
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"authenticated"}, got, t)
+
+	// Without the certificate the handshake fails.
+	conn = tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t)
+	_, err := Ep.Remote(conn)(ctx, Req{})
+	tst.Is(true, err != nil, t)
+
+	_, err = srpc.NewTransport("http://localhost", nil, nil, srpc.WithClientCertificate(cert, roots))
+	tst.Is(true, errors.Is(err, srpc.ErrBadOrigin), t)
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{"secure"}, nil })
+	plain := httptest.NewServer(mux)
+	t.Cleanup(plain.Close)
+	mux.HandleFunc("POST /downgrade", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+"/foo", http.StatusTemporaryRedirect)
+	})
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+
+	_, err := srpc.NewTransport(plain.URL, nil, nil, srpc.WithRequireHTTPS())
+	tst.Is(true, errors.Is(err, srpc.ErrBadOrigin), t)
+
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil, srpc.WithRequireHTTPS(), srpc.WithFollowRedirects()))(t)
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{}))(t)
+	tst.Is(Resp{"secure"}, got, t)
+
+	downgrade := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/downgrade")
+	_, err = downgrade.Remote(conn)(ctx, Req{})
+	tst.Is(true, errors.Is(err, srpc.ErrBadOrigin), t)
+}
+
+func TestTransportDrain(t *testing.T) {
+	ctx := tst.Go(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		close(started)
+		<-release
+		return Resp{req.B}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	tst.No(conn.Wait(ctx), t)
+
+	result := make(chan error)
+	go func() {
+		_, err := Ep.Remote(conn)(ctx, Req{"slow"})
+		result <- err
+	}()
+	<-started
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	tst.Is(context.DeadlineExceeded, conn.Drain(short), t)
+	_, err := Ep.Remote(conn)(ctx, Req{"new"})
+	tst.Is(true, errors.Is(err, srpc.ErrTransportDraining), t)
+
+	close(release)
+	tst.No(conn.Drain(ctx), t)
+	tst.No(<-result, t)
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		if req.B == "fail" {
+			return Resp{}, srpc.BadRequest(strings.Repeat("e", 100))
+		}
+		return Resp{req.B}, nil
+	}, srpc.WithResponseCompression(srpc.GzipEncoding))
+	conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithMaxResponseBytes(50), srpc.WithAcceptEncoding(srpc.GzipEncoding)))(t)
+
+	got := tst.Do(Ep.Remote(conn)(ctx, Req{"small"}))(t)
+	tst.Is(Resp{"small"}, got, t)
+	exact := strings.Repeat("x", 50-len(`{"A":""}`))
+	got = tst.Do(Ep.Remote(conn)(ctx, Req{exact}))(t)
+	tst.Is(Resp{exact}, got, t)
+
+	// Compressed responses are limited once decompressed.
+	_, err := Ep.Remote(conn)(ctx, Req{strings.Repeat("x", 1000)})
+	tst.Is(true, errors.Is(err, srpc.ErrResponseTooLarge), t)
+	// Errors keep their status and the truncated message.
+	_, err = Ep.Remote(conn)(ctx, Req{"fail"})
+	tst.Is(true, errors.Is(err, srpc.ErrResponseTooLarge), t)
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusBadRequest, werr.Code, t)
+	tst.Is(strings.Repeat("e", 50), werr.Msg, t)
+}
+
+func TestTransportClone(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{strings.Join([]string{
+			srpc.HeaderFromContext(ctx, "X-Tenant"),
+			srpc.HeaderFromContext(ctx, "X-App"),
+			srpc.HeaderFromContext(ctx, "Cookie"),
+			srpc.HeaderFromContext(ctx, "Authorization"),
+		}, "|")}, nil
+	}, srpc.WithHeadersInContext("X-Tenant", "X-App", "Cookie", "Authorization"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	base := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), []*http.Cookie{{Name: "session", Value: "base"}},
+		srpc.WithHeaders(http.Header{"X-App": {"app"}, "X-Tenant": {"none"}}),
+		srpc.WithBasicAuth("base", "pw")))(t)
+	tenant := base.Clone(
+		srpc.WithCookies(&http.Cookie{Name: "session", Value: "tenant"}),
+		srpc.WithHeaders(http.Header{"X-Tenant": {"acme"}}),
+		srpc.WithTokenProvider(func(context.Context) (string, error) { return "tok", nil }))
+
+	got := tst.Do(Ep.Remote(tenant)(ctx, Req{}))(t)
+	tst.Is(Resp{"acme|app|session=tenant|Bearer tok"}, got, t)
+	got = tst.Do(Ep.Remote(base)(ctx, Req{}))(t)
+	tst.Is(Resp{"none|app|session=base|Basic YmFzZTpwdw=="}, got, t)
+}
+
+func TestSharedTransport(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	var (
+		mu    sync.Mutex
+		saved string
+	)
+	set := srpc.EndpointW[Req](srpc.NewEndpointJSON[struct{}, Req](http.MethodPut, "/value"))
+	set.Register(mux, func(ctx context.Context, req Req) error {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = req.B
+		return nil
+	})
+	get := srpc.EndpointR[Resp](srpc.NewEndpointJSON[Resp, struct{}](http.MethodGet, "/value"))
+	get.Register(mux, func(ctx context.Context) (Resp, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return Resp{saved}, nil
+	})
+	reset := srpc.NewEndpointN(http.MethodDelete, "/value")
+	reset.Register(mux, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = ""
+		return nil
+	})
+	echo := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/echo")
+	echo.Register(mux, func(ctx context.Context, req Req) (Resp, error) { return Resp{req.B}, nil })
+
+	conn := tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	tst.No(srpc.RemoteW(conn, set)(ctx, Req{"v"}), t)
+	tst.Is(Resp{"v"}, tst.Do(srpc.RemoteR(conn, get)(ctx))(t), t)
+	tst.No(srpc.RemoteN(conn, reset)(ctx), t)
+	tst.Is(Resp{}, tst.Do(srpc.RemoteR(conn, get)(ctx))(t), t)
+	tst.Is(Resp{"hi"}, tst.Do(srpc.Remote(conn, echo)(ctx, Req{"hi"}))(t), t)
+}
+
+func TestCoalescing(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/expensive")
+	var (
+		calls   atomic.Int32
+		release = make(chan struct{})
+	)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		calls.Add(1)
+		<-release
+		if req.B == "bad" {
+			return Resp{}, srpc.BadRequest("bad")
+		}
+		return Resp{req.B}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(mux, srpc.WithCoalescing()))(t)
+	c := ep.Remote(conn)
+
+	const callers = 5
+	type result struct {
+		resp Resp
+		err  error
+	}
+	results := make(chan result, 2*callers)
+	for _, b := range []string{"ok", "bad"} {
+		for range callers {
+			go func() {
+				resp, err := c(ctx, Req{b})
+				results <- result{resp, err}
+			}()
+		}
+	}
+	for srpc.FlightWaiters(conn) < 2*callers {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	close(release)
+
+	var oks, bads int
+	for range 2 * callers {
+		r := <-results
+		switch {
+		case r.err == nil:
+			tst.Is(Resp{"ok"}, r.resp, t)
+			oks++
+		case srpc.IsBadRequest(r.err):
+			bads++
+		default:
+			t.Errorf("unexpected error: %v", r.err)
+		}
+	}
+	tst.Is(callers, oks, t)
+	tst.Is(callers, bads, t)
+	tst.Is(int32(2), calls.Load(), t)
+
+	// Calls that are not concurrent are not coalesced.
+	tst.Do(c(ctx, Req{"ok"}))(t)
+	tst.Is(int32(3), calls.Load(), t)
+}
+
+func TestCoalescingRefused(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/expensive")
+	tokens := func(ctx context.Context) (string, error) { return "token", nil }
+	tcs := []struct {
+		name string
+		opts []srpc.TransportOption
+		ctx  func(context.Context) context.Context
+	}{
+		{name: "PrepareHooks", opts: []srpc.TransportOption{srpc.WithTokenProvider(tokens)}},
+		{name: "ResponseInfo", ctx: func(ctx context.Context) context.Context {
+			return srpc.WithResponseInfo(ctx, &srpc.ResponseInfo{})
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				calls   atomic.Int32
+				release = make(chan struct{})
+			)
+			mux := http.NewServeMux()
+			ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+				calls.Add(1)
+				<-release
+				return Resp{req.B}, nil
+			})
+			conn := tst.Do(srpc.NewInMemoryTransport(mux, append(tc.opts, srpc.WithCoalescing())...))(t)
+
+			const callers = 2
+			errs := make(chan error, callers)
+			for range callers {
+				cctx := ctx
+				if tc.ctx != nil {
+					cctx = tc.ctx(ctx)
+				}
+				go func() {
+					_, err := ep.Remote(conn)(cctx, Req{"ok"})
+					errs <- err
+				}()
+			}
+			// Both calls reach the server, as they are not coalesced.
+			for calls.Load() < callers {
+				select {
+				case <-ctx.Done():
+					t.Fatal(ctx.Err())
+				case <-time.After(time.Millisecond):
+				}
+			}
+			close(release)
+			for range callers {
+				tst.No(<-errs, t)
+			}
+		})
+	}
+}
+
+func TestCoalescingDeadline(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/expensive")
+	var (
+		calls    atomic.Int32
+		timeouts = make(chan string, 3)
+		release  = make(chan struct{})
+	)
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		calls.Add(1)
+		<-release
+		return Resp{req.B}, nil
+	})
+	conn := tst.Do(srpc.NewInMemoryTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts <- r.Header.Get(srpc.TimeoutHeader)
+		mux.ServeHTTP(w, r)
+	}), srpc.WithCoalescing()))(t)
+	c := ep.Remote(conn)
+
+	errs := make(chan error, 3)
+	call := func(ctx context.Context) {
+		go func() {
+			_, err := c(ctx, Req{"ok"})
+			errs <- err
+		}()
+	}
+	waitFor := func(cond func() bool) {
+		for !cond() {
+			select {
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+	leader, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	call(leader)
+	waitFor(func() bool { return calls.Load() == 1 })
+	tst.Is(true, <-timeouts != "", t)
+
+	// Callers with an earlier deadline wait for the call in flight.
+	earlier, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	call(earlier)
+	waitFor(func() bool { return srpc.FlightWaiters(conn) == 2 })
+
+	// Callers without a deadline would be bound by the one of the call in flight.
+	call(context.WithoutCancel(ctx))
+	waitFor(func() bool { return calls.Load() == 2 })
+	tst.Is("", <-timeouts, t)
+
+	close(release)
+	for range 3 {
+		tst.No(<-errs, t)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		switch req.B {
+		case "new":
+			srpc.SetStatus(ctx, http.StatusCreated)
+			srpc.ResponseHeader(ctx).Set("Location", "/items/1")
+		case "created":
+			return srpc.Created(ctx, "/items/2", Resp{req.B}), nil
+		case "invalid":
+			srpc.SetStatus(ctx, http.StatusNotFound)
+		}
+		return Resp{req.B}, nil
+	})
+	accept := srpc.EndpointW[Req](srpc.NewEndpointJSON[struct{}, Req](http.MethodPost, "/accept"))
+	accept.Register(mux, func(ctx context.Context, req Req) error {
+		srpc.SetStatus(ctx, http.StatusAccepted)
+		return nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for name, conn := range map[string]*srpc.Transport{
+		"InMemory": tst.Do(srpc.NewInMemoryTransport(mux))(t),
+		"HTTP":     tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var info srpc.ResponseInfo
+			got := tst.Do(Ep.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{"new"}))(t)
+			tst.Is(Resp{"new"}, got, t)
+			tst.Is(http.StatusCreated, info.Status, t)
+			tst.Is("/items/1", info.Header.Get("Location"), t)
+
+			got = tst.Do(Ep.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{"created"}))(t)
+			tst.Is(Resp{"created"}, got, t)
+			tst.Is(http.StatusCreated, info.Status, t)
+			tst.Is("/items/2", info.Header.Get("Location"), t)
+
+			got = tst.Do(Ep.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{"invalid"}))(t)
+			tst.Is(Resp{"invalid"}, got, t)
+			tst.Is(http.StatusOK, info.Status, t)
+
+			tst.No(accept.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{}), t)
+			tst.Is(http.StatusAccepted, info.Status, t)
+
+			missing := srpc.NewEndpointJSON[Resp, Req](http.MethodPost, "/missing")
+			_, err := missing.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{})
+			tst.Is(true, srpc.IsNotFound(err), t)
+			tst.Is(http.StatusNotFound, info.Status, t)
+		})
+	}
+}
+
+func TestResponseHook(t *testing.T) {
+	ctx := tst.Go(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Trailer", "X-Checksum")
+		_, _ = w.Write([]byte(`{"A":"ok"}`))
+		w.Header().Set("X-Checksum", "42")
+	}))
+	t.Cleanup(srv.Close)
+	conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithCoalescing()))(t)
+	ep := srpc.NewEndpointJSON[Resp, Req](http.MethodGet, "/")
+
+	var hResp *http.Response
+	got := tst.Do(ep.Remote(conn)(srpc.WithResponseHook(ctx, func(r *http.Response) { hResp = r }), Req{}))(t)
+	tst.Is(Resp{"ok"}, got, t)
+	tst.Is(http.StatusOK, hResp.StatusCode, t)
+	tst.Is("42", hResp.Trailer.Get("X-Checksum"), t)
+}
+
+type FormReq struct {
+	Name, Email string
+}
+
+func (f FormReq) Validate() error {
+	v := &srpc.ValidationError{Fields: map[string]string{}}
+	if f.Name == "" {
+		v.Fields["name"] = "required"
+	}
+	if !strings.Contains(f.Email, "@") {
+		v.Fields["email"] = "not an email address"
+	}
+	if len(v.Fields) > 0 {
+		return v
+	}
+	return nil
+}
+
+func TestValidationError(t *testing.T) {
+	ctx := tst.Go(t)
+	ep := srpc.NewEndpointJSON[Resp, FormReq](http.MethodPost, "/form")
+	mux := http.NewServeMux()
+	ep.Register(mux, func(ctx context.Context, req FormReq) (Resp, error) {
+		if req.Name == "taken" {
+			return Resp{}, &srpc.ValidationError{Fields: map[string]string{"name": "already taken"}}
+		}
+		return Resp{"ok"}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := ep.RemoteWithOrigin(srv.URL)
+
+	tst.Is(Resp{"ok"}, tst.Do(c(ctx, FormReq{"me", "me@example.com"}))(t), t)
+
+	_, err := c(ctx, FormReq{Email: "nope"})
+	tst.Is(true, errors.Is(err, srpc.ErrUnprocessableEntity), t)
+	v := tst.DoB(errors.AsType[*srpc.ValidationError](err))(t)
+	tst.Is(map[string]string{"name": "required", "email": "not an email address"}, v.Fields, t)
+	tst.Is("invalid request: email: not an email address, name: required", v.Error(), t)
+
+	_, err = c(ctx, FormReq{"taken", "me@example.com"})
+	v = tst.DoB(errors.AsType[*srpc.ValidationError](err))(t)
+	tst.Is(map[string]string{"name": "already taken"}, v.Fields, t)
+
+	// Clients that validate requests return the same error without calling the server.
+	cep := srpc.NewEndpointJSON[Resp, FormReq](http.MethodPost, "/form", srpc.WithClientValidation())
+	_, err = cep.Remote(tst.Do(srpc.NewTransport("http://localhost:1", nil, nil))(t))(ctx, FormReq{Email: "me@example.com"})
+	v = tst.DoB(errors.AsType[*srpc.ValidationError](err))(t)
+	tst.Is(map[string]string{"name": "required"}, v.Fields, t)
+}
+
+func TestExpectContinue(t *testing.T) {
+	ctx := tst.Go(t)
+	auth := srpc.AuthenticatorFunc(func(ctx context.Context, r *http.Request) (context.Context, error) {
+		if r.Header.Get("X-User") == "" {
+			return nil, srpc.Unauthorized("no user")
+		}
+		return ctx, nil
+	})
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		return Resp{strconv.Itoa(len(req.B))}, nil
+	}, srpc.WithAuthenticator(auth), srpc.WithMaxRequestBytes(1024))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	tcs := []struct {
+		name      string
+		user      string
+		size      int
+		continued bool
+		wantErr   func(error) bool
+	}{
+		{name: "Accepted", user: "alice", size: 10, continued: true},
+		{name: "Unauthenticated", size: 10, wantErr: srpc.IsUnauthorized},
+		{name: "TooLarge", user: "alice", size: 2048, wantErr: func(err error) bool {
+			we, ok := errors.AsType[*srpc.WireError](err)
+			return ok && we.Code == http.StatusRequestEntityTooLarge
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var waited, continued atomic.Bool
+			trace := &httptrace.ClientTrace{
+				Wait100Continue: func() { waited.Store(true) },
+				Got100Continue:  func() { continued.Store(true) },
+			}
+			conn := tst.Do(srpc.NewTransport(srv.URL, nil, nil, srpc.WithExpectContinue(),
+				srpc.WithHeaders(http.Header{"X-User": {tc.user}})))(t)
+			got, err := Ep.Remote(conn)(httptrace.WithClientTrace(ctx, trace), Req{strings.Repeat("x", tc.size)})
+			if tc.wantErr != nil {
+				tst.Is(true, tc.wantErr(err), t)
+			} else {
+				tst.No(err, t)
+				tst.Is(Resp{strconv.Itoa(tc.size)}, got, t)
+			}
+			tst.Is(true, waited.Load(), t)
+			tst.Is(tc.continued, continued.Load(), t)
+		})
+	}
+}
+
+func TestPreload(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		srpc.Preload(ctx, "/a.js>; rel=stylesheet, </evil.css", "script")
+		srpc.Preload(ctx, "/b.js", "script; crossorigin")
+		srpc.Preload(ctx, "/c d.js", "script")
+		return Resp{req.B}, nil
+	})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodPost, "/foo", strings.NewReader(`{"B":"x"}`)))
+	tst.Is([]string{
+		"</a.js%3E%3B%20rel=stylesheet%2C%20%3C/evil.css>; rel=preload; as=script",
+		"</c%20d.js>; rel=preload; as=script",
+	}, rec.Header().Values("Link"), t)
+}
+
+func TestEarlyHints(t *testing.T) {
+	ctx := tst.Go(t)
+	mux := http.NewServeMux()
+	Ep.Register(mux, func(ctx context.Context, req Req) (Resp, error) {
+		srpc.Preload(ctx, "/app.js", "script")
+		srpc.Preload(ctx, "/app.css", "style")
+		srpc.SendEarlyHints(ctx)
+		return Resp{req.B}, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	want := []string{"</app.js>; rel=preload; as=script", "</app.css>; rel=preload; as=style"}
+
+	var hints []string
+	trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, h textproto.MIMEHeader) error {
+		if code == http.StatusEarlyHints {
+			hints = h.Values("Link")
+		}
+		return nil
+	}}
+	var info srpc.ResponseInfo
+	conn := tst.Do(srpc.NewTransport(srv.URL, srv.Client(), nil))(t)
+	got := tst.Do(Ep.Remote(conn)(srpc.WithResponseInfo(httptrace.WithClientTrace(ctx, trace), &info), Req{"page"}))(t)
+	tst.Is(Resp{"page"}, got, t)
+	tst.Is(want, hints, t)
+	tst.Is(http.StatusOK, info.Status, t)
+	tst.Is(want, info.Header.Values("Link"), t)
+
+	// Hints are not delivered in memory.
+	conn = tst.Do(srpc.NewInMemoryTransport(mux))(t)
+	got = tst.Do(Ep.Remote(conn)(srpc.WithResponseInfo(ctx, &info), Req{"page"}))(t)
+	tst.Is(Resp{"page"}, got, t)
+	tst.Is(http.StatusOK, info.Status, t)
+}
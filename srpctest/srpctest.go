@@ -0,0 +1,81 @@
+// Package srpctest provides fake procedures to test code that calls remote procedures,
+// without networking.
+package srpctest
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/empijei/srpc"
+)
+
+// Returning returns a procedure that always returns resp.
+func Returning[Response, Request any](resp Response) srpc.Procedure[Response, Request] {
+	return func(context.Context, Request) (Response, error) {
+		return resp, nil
+	}
+}
+
+// Failing returns a procedure that always fails as remote procedures do when the server
+// responds with the given status and message.
+func Failing[Response, Request any](status int, msg string) srpc.Procedure[Response, Request] {
+	return func(context.Context, Request) (Response, error) {
+		var zero Response
+		return zero, Error(status, msg)
+	}
+}
+
+// Error returns the error that remote procedures return when the server responds with the given
+// status and message. It matches the sentinel error of the status, for example [srpc.ErrNotFound].
+func Error(status int, msg string) error {
+	return srpc.NewWireError(status, msg)
+}
+
+// Fake serves p for ep in memory and returns the remote procedure that calls it.
+//
+// Unlike calling p directly, requests and responses go through the codecs of ep and errors returned by p
+// reach the caller as they would over the network: for example [srpc.NotFound] becomes a [*srpc.WireError]
+// with status 404.
+func Fake[Response, Request any](ep srpc.Endpoint[Response, Request], p srpc.Procedure[Response, Request], opts ...srpc.ServerOption) srpc.Procedure[Response, Request] {
+	mux := http.NewServeMux()
+	ep.Register(mux, p, opts...)
+	conn, err := srpc.NewInMemoryTransport(mux)
+	if err != nil {
+		panic(err)
+	}
+	return ep.Remote(conn)
+}
+
+// Recorder wraps a procedure and records the requests it receives.
+//
+// It is safe for concurrent use.
+type Recorder[Response, Request any] struct {
+	p srpc.Procedure[Response, Request]
+
+	mu   sync.Mutex
+	reqs []Request
+}
+
+// Record returns a Recorder that wraps p.
+func Record[Response, Request any](p srpc.Procedure[Response, Request]) *Recorder[Response, Request] {
+	return &Recorder[Response, Request]{p: p}
+}
+
+// Procedure returns the procedure that records requests and calls the wrapped one.
+func (r *Recorder[Response, Request]) Procedure() srpc.Procedure[Response, Request] {
+	return func(ctx context.Context, req Request) (Response, error) {
+		r.mu.Lock()
+		r.reqs = append(r.reqs, req)
+		r.mu.Unlock()
+		return r.p(ctx, req)
+	}
+}
+
+// Requests returns the requests received so far, in order.
+func (r *Recorder[Response, Request]) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.reqs)
+}
@@ -0,0 +1,66 @@
+package srpctest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/empijei/srpc"
+	"github.com/empijei/srpc/srpctest"
+	"github.com/empijei/tst"
+)
+
+type (
+	GetUser struct{ ID string }
+	User    struct{ Name string }
+)
+
+var getUser = srpc.NewEndpointJSON[User, GetUser](http.MethodGet, "/user")
+
+// greet is the code under test, which depends on a remote procedure.
+func greet(ctx context.Context, get srpc.Procedure[User, GetUser], id string) (string, error) {
+	u, err := get(ctx, GetUser{id})
+	if errors.Is(err, srpc.ErrNotFound) {
+		return "Hello, stranger", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "Hello, " + u.Name, nil
+}
+
+func TestFakes(t *testing.T) {
+	ctx := tst.Go(t)
+
+	got := tst.Do(greet(ctx, srpctest.Returning[User, GetUser](User{"Ada"}), "1"))(t)
+	tst.Is("Hello, Ada", got, t)
+
+	got = tst.Do(greet(ctx, srpctest.Failing[User, GetUser](http.StatusNotFound, "no such user"), "1"))(t)
+	tst.Is("Hello, stranger", got, t)
+
+	_, err := greet(ctx, srpctest.Failing[User, GetUser](http.StatusInternalServerError, "boom"), "1")
+	tst.Is(true, errors.Is(err, srpc.ErrInternal), t)
+}
+
+func TestFakeEndpoint(t *testing.T) {
+	ctx := tst.Go(t)
+	rec := srpctest.Record(func(ctx context.Context, req GetUser) (User, error) {
+		if req.ID != "1" {
+			return User{}, srpc.NotFound("no such user")
+		}
+		return User{"Ada"}, nil
+	})
+	get := srpctest.Fake(getUser, rec.Procedure())
+
+	got := tst.Do(greet(ctx, get, "1"))(t)
+	tst.Is("Hello, Ada", got, t)
+	got = tst.Do(greet(ctx, get, "2"))(t)
+	tst.Is("Hello, stranger", got, t)
+
+	_, err := get(ctx, GetUser{"2"})
+	werr := tst.DoB(errors.AsType[*srpc.WireError](err))(t)
+	tst.Is(http.StatusNotFound, werr.Code, t)
+	tst.Is("no such user", werr.Msg, t)
+	tst.Is([]GetUser{{"1"}, {"2"}, {"2"}}, rec.Requests(), t)
+}
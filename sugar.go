@@ -8,16 +8,18 @@ import "context"
 
 type (
 	// EndpointW is like [Endpoint] but for functions that return no content.
+	//
+	// Successful calls are answered with 204 No Content.
 	EndpointW[Request any] Endpoint[struct{}, Request]
 	// ProcedureW is like [Procedure], but for functions that return no value.
 	ProcedureW[Request any] func(ctx context.Context, req Request) error
 )
 
 // Register is like [Endpoint.Register] for EndpointW.
-func (e *EndpointW[Request]) Register(m Mux, h ProcedureW[Request]) {
+func (e *EndpointW[Request]) Register(m Mux, h ProcedureW[Request], opts ...ServerOption) {
 	(*Endpoint[struct{}, Request])(e).Register(m, func(ctx context.Context, req Request) (struct{}, error) {
 		return struct{}{}, h(ctx, req)
-	})
+	}, opts...)
 }
 
 // Remote is like [Endpoint.Remote] for EndpointW.
@@ -31,11 +33,7 @@ func (e *EndpointW[Request]) Remote(conn *Transport) ProcedureW[Request] {
 
 // RemoteWithOrigin is like [Endpoint.RemoteWithOrigin] for EndpointW.
 func (e *EndpointW[Request]) RemoteWithOrigin(origin string) ProcedureW[Request] {
-	conn, err := NewTransport(origin, nil, nil)
-	if err != nil {
-		panic(err)
-	}
-	return e.Remote(conn)
+	return e.Remote(originTransport(origin))
 }
 
 ///////////////
@@ -50,10 +48,10 @@ type (
 )
 
 // Register is like [Endpoint.Register] for [EndpointR].
-func (e *EndpointR[Response]) Register(m Mux, h ProcedureR[Response]) {
+func (e *EndpointR[Response]) Register(m Mux, h ProcedureR[Response], opts ...ServerOption) {
 	(*Endpoint[Response, struct{}])(e).Register(m, func(ctx context.Context, _ struct{}) (Response, error) {
 		return h(ctx)
-	})
+	}, opts...)
 }
 
 // Remote is like [Endpoint.Remote] for [EndpointR].
@@ -66,9 +64,73 @@ func (e *EndpointR[Response]) Remote(conn *Transport) ProcedureR[Response] {
 
 // RemoteWithOrigin is like [Endpoint.RemoteWithOrigin] for [EndpointR].
 func (e *EndpointR[Response]) RemoteWithOrigin(origin string) ProcedureR[Response] {
-	conn, err := NewTransport(origin, nil, nil)
-	if err != nil {
-		panic(err)
+	return e.Remote(originTransport(origin))
+}
+
+/////////////
+// Nullary //
+/////////////
+
+type (
+	// EndpointN is like [Endpoint] for functions that take no inputs and return no value,
+	// such as deletions of resources identified by path wildcards.
+	//
+	// Wildcards can be read with [PathValue] on the server and set with [WithPathValue] on the client.
+	EndpointN Endpoint[struct{}, struct{}]
+	// ProcedureN is like [Procedure] for functions that take no parameters and return no value.
+	ProcedureN func(ctx context.Context) error
+)
+
+// NewEndpointN constructs an [EndpointN] with empty request and response bodies.
+//
+// It is meant to be used with the DELETE method, or POST for actions.
+func NewEndpointN(method, path string, opts ...EndpointOption) EndpointN {
+	return EndpointN(NewEndpointJSON[struct{}, struct{}](method, path, opts...))
+}
+
+// Register is like [Endpoint.Register] for [EndpointN].
+func (e *EndpointN) Register(m Mux, h ProcedureN, opts ...ServerOption) {
+	(*Endpoint[struct{}, struct{}])(e).Register(m, func(ctx context.Context, _ struct{}) (struct{}, error) {
+		return struct{}{}, h(ctx)
+	}, opts...)
+}
+
+// Remote is like [Endpoint.Remote] for [EndpointN].
+func (e *EndpointN) Remote(conn *Transport) ProcedureN {
+	cl := (*Endpoint[struct{}, struct{}])(e).Remote(conn)
+	return func(ctx context.Context) error {
+		_, err := cl(ctx, struct{}{})
+		return err
 	}
+}
+
+// RemoteWithOrigin is like [Endpoint.RemoteWithOrigin] for [EndpointN].
+func (e *EndpointN) RemoteWithOrigin(origin string) ProcedureN {
+	return e.Remote(originTransport(origin))
+}
+
+////////////////
+// Transports //
+////////////////
+
+// Remote is like [Endpoint.Remote], it reads as a call on the shared transport:
+//
+//	getUser := srpc.Remote(conn, GetUser)
+func Remote[Response, Request any](conn *Transport, e Endpoint[Response, Request]) Procedure[Response, Request] {
+	return e.Remote(conn)
+}
+
+// RemoteW is like [Remote] for [EndpointW].
+func RemoteW[Request any](conn *Transport, e EndpointW[Request]) ProcedureW[Request] {
+	return e.Remote(conn)
+}
+
+// RemoteR is like [Remote] for [EndpointR].
+func RemoteR[Response any](conn *Transport, e EndpointR[Response]) ProcedureR[Response] {
+	return e.Remote(conn)
+}
+
+// RemoteN is like [Remote] for [EndpointN].
+func RemoteN(conn *Transport, e EndpointN) ProcedureN {
 	return e.Remote(conn)
 }
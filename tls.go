@@ -0,0 +1,93 @@
+package srpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithClientCertificate makes the transport authenticate with cert to servers that require
+// mutual TLS, and verify servers with the certificate authorities in roots, or the system ones if roots is nil.
+//
+// The origin must be https. If the transport was given a client, its [*http.Transport] is cloned
+// and its other TLS settings are kept.
+func WithClientCertificate(cert tls.Certificate, roots *x509.CertPool) TransportOption {
+	return func(t *Transport) {
+		t.clientCert = &cert
+		t.roots = roots
+	}
+}
+
+// WithRequireHTTPS makes [NewTransport] reject origins that are not https, and calls fail
+// instead of following redirects to other schemes.
+//
+// It protects credentials and data from being sent in the clear because of a misconfigured origin.
+func WithRequireHTTPS() TransportOption {
+	return func(t *Transport) { t.requireHTTPS = true }
+}
+
+// maxRedirects is the number of redirects followed by default, as by [http.Client].
+const maxRedirects = 10
+
+// httpsOnly returns a copy of cl that refuses to follow redirects to URLs that are not https.
+func httpsOnly(cl *http.Client) *http.Client {
+	c := *cl
+	check := c.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if check != nil {
+			if err := check(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !strings.EqualFold(req.URL.Scheme, "https") {
+			return fmt.Errorf("%w: redirect to a non-https URL: %q", ErrBadOrigin, req.URL.Redacted())
+		}
+		return nil
+	}
+	return &c
+}
+
+// configureTLS configures the client of t to use the client certificate, for the origin u.
+func (t *Transport) configureTLS(u *url.URL) error {
+	if !strings.EqualFold(u.Scheme, "https") {
+		return fmt.Errorf("%w: client certificates need an https origin: %q", ErrBadOrigin, t.origin)
+	}
+	cl, rt, err := t.cloneClient()
+	if err != nil {
+		return err
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if rt.TLSClientConfig != nil {
+		cfg = rt.TLSClientConfig.Clone()
+	}
+	cfg.Certificates = []tls.Certificate{*t.clientCert}
+	if t.roots != nil {
+		cfg.RootCAs = t.roots
+	}
+	rt.TLSClientConfig = cfg
+	cl.Transport = rt
+	t.client = cl
+	return nil
+}
+
+// cloneClient returns copies of the client of t and of its [*http.Transport], so that they can be modified.
+func (t *Transport) cloneClient() (*http.Client, *http.Transport, error) {
+	cl := http.Client{}
+	if t.client != nil {
+		cl = *t.client
+	}
+	base := cl.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ht, ok := base.(*http.Transport)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: the client must use a *http.Transport, got %T", ErrBadOrigin, base)
+	}
+	return &cl, ht.Clone(), nil
+}
@@ -0,0 +1,64 @@
+package srpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// unixHost is the default Host of requests sent over unix domain sockets.
+const unixHost = "localhost"
+
+// dialUnix configures t to send requests to the unix domain socket at the path of u.
+//
+// The "host" query parameter sets the Host of requests, and the "path" one the path that is prepended
+// to the ones of endpoints, for servers that are mounted under a prefix.
+func (t *Transport) dialUnix(u *url.URL) error {
+	switch {
+	case u.Path == "":
+		return fmt.Errorf("%w: missing socket path: %q", ErrBadOrigin, t.origin)
+	case u.Host != "":
+		return fmt.Errorf("%w: unix origins must not have a host: %q", ErrBadOrigin, t.origin)
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return fmt.Errorf("%w: invalid query: %q", ErrBadOrigin, u.RawQuery)
+	}
+	host, base := unixHost, ""
+	for k, v := range q {
+		switch {
+		case len(v) != 1:
+			return fmt.Errorf("%w: query parameter %q must have one value", ErrBadOrigin, k)
+		case k == "host":
+			host = v[0]
+		case k == "path":
+			base = strings.TrimSuffix(v[0], "/")
+		default:
+			return fmt.Errorf("%w: unknown query parameter %q", ErrBadOrigin, k)
+		}
+	}
+	if h, err := url.Parse("http://" + host); err != nil || h.Host != host || host == "" {
+		return fmt.Errorf("%w: invalid host: %q", ErrBadOrigin, host)
+	}
+	if base != "" && (!strings.HasPrefix(base, "/") || strings.ContainsAny(base, "?#")) {
+		return fmt.Errorf("%w: invalid path: %q", ErrBadOrigin, base)
+	}
+
+	cl, rt, err := t.cloneClient()
+	if err != nil {
+		return err
+	}
+	socket := u.Path
+	var d net.Dialer
+	rt.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", socket)
+	}
+	// Requests must reach the socket, not a proxy.
+	rt.Proxy = nil
+	cl.Transport = rt
+	t.client = cl
+	t.origin = "http://" + host + base
+	return nil
+}
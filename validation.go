@@ -0,0 +1,82 @@
+package srpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrorKindHeader is set on error responses whose body is structured, to tell clients how to decode it.
+const ErrorKindHeader = "Srpc-Error-Kind"
+
+// validationKind is the [ErrorKindHeader] value of responses that carry a [ValidationError].
+const validationKind = "validation"
+
+// ErrUnprocessableEntity is the sentinel error for the 422 status, used for [ValidationError].
+var ErrUnprocessableEntity error = statusError(http.StatusUnprocessableEntity)
+
+// ValidationError reports which fields of a request are invalid.
+//
+// When it is returned by [Validable.Validate], or by a procedure, the server responds with
+// 422 Unprocessable Entity and the fields as JSON. Remote procedures return it as a *ValidationError,
+// which can be retrieved with [errors.As].
+//
+// As for any validation error, messages are sent to the client and should not contain secret information.
+type ValidationError struct {
+	// Fields maps the names of the invalid fields to the reason why they are invalid.
+	Fields map[string]string `json:"fields"`
+}
+
+// Error implements [error].
+func (v *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid request")
+	for i, f := range slices.Sorted(maps.Keys(v.Fields)) {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: %s", f, v.Fields[f])
+	}
+	return b.String()
+}
+
+// Message implements [ErrorResponse].
+func (v *ValidationError) Message() string { return "Invalid request." }
+
+// Status implements [ErrorResponse].
+func (v *ValidationError) Status() int { return http.StatusUnprocessableEntity }
+
+// Is reports whether target is [ErrUnprocessableEntity].
+func (v *ValidationError) Is(target error) bool { return target == ErrUnprocessableEntity }
+
+// writeValidationError responds with the fields of v.
+func writeValidationError(w http.ResponseWriter, v *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set(ErrorKindHeader, validationKind)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// readValidationError decodes the [ValidationError] in the body of an error response, if it has one.
+func readValidationError(resp *http.Response, body []byte) (*ValidationError, bool) {
+	if resp.Header.Get(ErrorKindHeader) != validationKind {
+		return nil, false
+	}
+	var v ValidationError
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, false
+	}
+	return &v, true
+}
+
+// asValidationError returns the [ValidationError] in err's tree, if any.
+func asValidationError(err error) (*ValidationError, bool) {
+	return errors.AsType[*ValidationError](err)
+}